@@ -12,6 +12,13 @@ type User interface {
 	GetExternalData(string) (string, bool)
 }
 
+// ScopedUser is an optional interface for users that have been granted scopes.
+type ScopedUser interface {
+	User
+	Scopes() []string
+	HasScope(string) bool
+}
+
 // A private key for context that only this package can access. This is important
 // to prevent collisions between different context uses
 var ctxUserKey = &contextKey{"user"}
@@ -29,6 +36,15 @@ func ForContext(ctx context.Context) User {
 	return raw
 }
 
+// ForContextOrAnonymous finds the user from the context,
+// returning an anonymous user with an empty ID if none is set.
+func ForContextOrAnonymous(ctx context.Context) User {
+	if user := ForContext(ctx); user != nil {
+		return user
+	}
+	return NewCtxUser("", "", "")
+}
+
 func WithUser(ctx context.Context, user User) context.Context {
 	r := context.WithValue(ctx, ctxUserKey, user)
 	return r
@@ -0,0 +1,27 @@
+package authn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForContextOrAnonymous(t *testing.T) {
+	t.Run("no user", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Nil(t, ForContext(ctx))
+		user := ForContextOrAnonymous(ctx)
+		if assert.NotNil(t, user) {
+			assert.Equal(t, "", user.ID())
+			assert.False(t, user.HasRole("user"))
+		}
+	})
+	t.Run("user", func(t *testing.T) {
+		ctx := WithUser(context.Background(), NewCtxUser("test", "", ""))
+		user := ForContextOrAnonymous(ctx)
+		if assert.NotNil(t, user) {
+			assert.Equal(t, "test", user.ID())
+		}
+	})
+}
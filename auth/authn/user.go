@@ -10,25 +10,30 @@ type CtxUser struct {
 	name         string
 	email        string
 	roles        map[string]bool
+	scopes       map[string]bool
 	externalData map[string]string
 }
 
 func NewCtxUser(id string, name string, email string) CtxUser {
-	a := newCtxUserWith(id, name, email, nil, nil)
+	a := newCtxUserWith(id, name, email, nil, nil, nil)
 	return a
 }
 
-func newCtxUserWith(id string, name string, email string, roles map[string]bool, externalData map[string]string) CtxUser {
+func newCtxUserWith(id string, name string, email string, roles map[string]bool, scopes map[string]bool, externalData map[string]string) CtxUser {
 	u := CtxUser{
 		id:           id,
 		name:         name,
 		email:        email,
 		roles:        map[string]bool{},
+		scopes:       map[string]bool{},
 		externalData: map[string]string{},
 	}
 	for k, v := range roles {
 		u.roles[k] = v
 	}
+	for k, v := range scopes {
+		u.scopes[k] = v
+	}
 	for k, v := range externalData {
 		u.externalData[k] = v
 	}
@@ -36,7 +41,7 @@ func newCtxUserWith(id string, name string, email string, roles map[string]bool,
 }
 
 func (user CtxUser) clone() CtxUser {
-	return newCtxUserWith(user.id, user.name, user.email, user.roles, user.externalData)
+	return newCtxUserWith(user.id, user.name, user.email, user.roles, user.scopes, user.externalData)
 }
 
 func (user CtxUser) Name() string {
@@ -100,3 +105,25 @@ func (user CtxUser) Roles() []string {
 	}
 	return keys
 }
+
+func (user CtxUser) WithScopes(scopes ...string) CtxUser {
+	newUser := user.clone()
+	for _, v := range scopes {
+		newUser.scopes[v] = true
+	}
+	return newUser
+}
+
+// HasScope checks if a User has been granted a scope.
+// Unlike roles, scopes are not implied by the admin role.
+func (user CtxUser) HasScope(scope string) bool {
+	return user.scopes[scope]
+}
+
+func (user CtxUser) Scopes() []string {
+	var keys []string
+	for k := range user.scopes {
+		keys = append(keys, k)
+	}
+	return keys
+}
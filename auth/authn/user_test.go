@@ -43,3 +43,25 @@ func TestUser_HasRole(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_HasScope(t *testing.T) {
+	testcases := []struct {
+		name     string
+		user     ScopedUser
+		scope    string
+		hasScope bool
+	}{
+		{"no scopes", NewCtxUser("test", "", ""), "feeds:read", false},
+		{"scope", NewCtxUser("test", "", "").WithScopes("feeds:read"), "feeds:read", true},
+		{"other scope", NewCtxUser("test", "", "").WithScopes("feeds:write"), "feeds:read", false},
+		{"admin", NewCtxUser("test", "", "").WithRoles("admin"), "feeds:read", false},
+		{"scope is not role", NewCtxUser("test", "", "").WithScopes("feeds:read"), "admin", false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.user.HasScope(tc.scope) != tc.hasScope {
+				t.Errorf("expected scope %s to be %t", tc.scope, tc.hasScope)
+			}
+		})
+	}
+}
@@ -11,12 +11,38 @@ import (
 	"github.com/form3tech-oss/jwt-go"
 	"github.com/interline-io/log"
 	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/tidwall/gjson"
 )
 
+// JWTConfig configures JWT validation and how users are built from claims.
+type JWTConfig struct {
+	JwtAudience      string
+	JwtIssuer        string
+	JwtPublicKeyFile string
+	UseEmailAsId     bool
+	// JwtRolesClaim is an optional path to a claim containing roles, e.g. "realm_access.roles".
+	// Paths use gjson syntax; escape literal dots in claim names with a backslash.
+	// The claim may be an array of strings or a space-delimited string.
+	// Scopes are always read from the standard "scope" claim and the "scp" claim.
+	JwtRolesClaim string
+}
+
 // JWTMiddleware checks and pulls user information from JWT in Authorization header.
 func JWTMiddleware(jwtAudience string, jwtIssuer string, pubKeyPath string, useEmailAsId bool) (func(http.Handler) http.Handler, error) {
+	return NewJWTMiddleware(JWTConfig{
+		JwtAudience:      jwtAudience,
+		JwtIssuer:        jwtIssuer,
+		JwtPublicKeyFile: pubKeyPath,
+		UseEmailAsId:     useEmailAsId,
+	})
+}
+
+// NewJWTMiddleware checks and pulls user information from JWT in Authorization header, using the provided config.
+func NewJWTMiddleware(cfg JWTConfig) (func(http.Handler) http.Handler, error) {
+	jwtAudience := cfg.JwtAudience
+	jwtIssuer := cfg.JwtIssuer
 	var verifyKey *rsa.PublicKey
-	verifyBytes, err := ioutil.ReadFile(pubKeyPath)
+	verifyBytes, err := ioutil.ReadFile(cfg.JwtPublicKeyFile)
 	if err != nil {
 		return nil, err
 	}
@@ -39,10 +65,22 @@ func JWTMiddleware(jwtAudience string, jwtIssuer string, pubKeyPath string, useE
 					return
 				}
 				userId := claims.Subject
-				if useEmailAsId {
+				if cfg.UseEmailAsId {
 					userId = claims.Email
 				}
 				jwtUser := authn.NewCtxUser(userId, claims.Subject, claims.Email)
+				payload, err := tokenPayload(tokenString[1])
+				if err != nil {
+					log.Error().Err(err).Msgf("invalid jwt payload")
+					http.Error(w, makeJsonError(http.StatusText(http.StatusUnauthorized)), http.StatusUnauthorized)
+					return
+				}
+				if cfg.JwtRolesClaim != "" {
+					jwtUser = jwtUser.WithRoles(parseListClaim(gjson.GetBytes(payload, cfg.JwtRolesClaim))...)
+				}
+				// Standard "scope" claim and the common "scp" variant
+				jwtUser = jwtUser.WithScopes(parseListClaim(gjson.GetBytes(payload, "scope"))...)
+				jwtUser = jwtUser.WithScopes(parseListClaim(gjson.GetBytes(payload, "scp"))...)
 				r = r.WithContext(authn.WithUser(r.Context(), jwtUser))
 			}
 			next.ServeHTTP(w, r)
@@ -77,6 +115,30 @@ func validateJwt(rsaPublicKey *rsa.PublicKey, jwtAudience string, jwtIssuer stri
 	return claims, nil
 }
 
+// tokenPayload returns the decoded claims segment of a validated token.
+func tokenPayload(tokenString string) ([]byte, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid token")
+	}
+	return jwt.DecodeSegment(parts[1])
+}
+
+// parseListClaim accepts either an array of strings or a space-delimited string.
+func parseListClaim(v gjson.Result) []string {
+	var roles []string
+	if v.IsArray() {
+		for _, item := range v.Array() {
+			if role := strings.TrimSpace(item.String()); role != "" {
+				roles = append(roles, role)
+			}
+		}
+	} else if v.Type == gjson.String {
+		roles = strings.Fields(v.String())
+	}
+	return roles
+}
+
 func makeJsonError(msg string) string {
 	a := map[string]string{
 		"error": msg,
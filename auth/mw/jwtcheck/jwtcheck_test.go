@@ -1,7 +1,151 @@
 package jwtcheck
 
-import "testing"
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/interline-io/transitland-mw/internal/anchecktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	testAudience = "test-audience"
+	testIssuer   = "test-issuer"
+)
 
 func TestJWTMiddleware(t *testing.T) {
-	// TODO
+	privKey, pubKeyPath := newTestKey(t)
+	tcs := []struct {
+		name   string
+		cfg    JWTConfig
+		claims jwt.MapClaims
+		code   int
+		user   authn.User
+	}{
+		{
+			"ok",
+			JWTConfig{},
+			jwt.MapClaims{"sub": "test"},
+			200,
+			authn.NewCtxUser("test", "", ""),
+		},
+		{
+			"email as id",
+			JWTConfig{UseEmailAsId: true},
+			jwt.MapClaims{"sub": "test", "email": "test@example.com"},
+			200,
+			authn.NewCtxUser("test@example.com", "", ""),
+		},
+		{
+			"invalid audience",
+			JWTConfig{},
+			jwt.MapClaims{"sub": "test", "aud": []string{"other"}},
+			401,
+			nil,
+		},
+		{
+			"roles array",
+			JWTConfig{JwtRolesClaim: "realm_access.roles"},
+			jwt.MapClaims{"sub": "test", "realm_access": map[string]any{"roles": []string{"tl_user_pro", "editor"}}},
+			200,
+			authn.NewCtxUser("test", "", "").WithRoles("tl_user_pro", "editor"),
+		},
+		{
+			"roles space delimited",
+			JWTConfig{JwtRolesClaim: "roles"},
+			jwt.MapClaims{"sub": "test", "roles": "tl_user_pro editor"},
+			200,
+			authn.NewCtxUser("test", "", "").WithRoles("tl_user_pro", "editor"),
+		},
+		{
+			"roles namespaced claim",
+			JWTConfig{JwtRolesClaim: `https://example\.com/roles`},
+			jwt.MapClaims{"sub": "test", "https://example.com/roles": []string{"admin"}},
+			200,
+			authn.NewCtxUser("test", "", "").WithRoles("admin"),
+		},
+		{
+			"scopes",
+			JWTConfig{},
+			jwt.MapClaims{"sub": "test", "scope": "feeds:read feeds:write"},
+			200,
+			authn.NewCtxUser("test", "", "").WithScopes("feeds:read", "feeds:write"),
+		},
+		{
+			"scopes scp",
+			JWTConfig{},
+			jwt.MapClaims{"sub": "test", "scp": []string{"feeds:read"}},
+			200,
+			authn.NewCtxUser("test", "", "").WithScopes("feeds:read"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"aud": []string{testAudience}, "iss": testIssuer}
+			for k, v := range tc.claims {
+				claims[k] = v
+			}
+			tokenString, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := tc.cfg
+			cfg.JwtAudience = testAudience
+			cfg.JwtIssuer = testIssuer
+			cfg.JwtPublicKeyFile = pubKeyPath
+			mwf, err := NewJWTMiddleware(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+			anchecktest.TestAuthMiddleware(t, req, mwf, tc.code, tc.user)
+		})
+	}
+}
+
+func TestParseListClaim(t *testing.T) {
+	tcs := []struct {
+		name   string
+		json   string
+		expect []string
+	}{
+		{"array", `{"roles":["a","b"]}`, []string{"a", "b"}},
+		{"string", `{"roles":"a b  c"}`, []string{"a", "b", "c"}},
+		{"empty array", `{"roles":[]}`, nil},
+		{"missing", `{}`, nil},
+		{"number", `{"roles":1}`, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, parseListClaim(gjson.Get(tc.json, "roles")))
+		})
+	}
+}
+
+func newTestKey(t testing.TB) (*rsa.PrivateKey, string) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyPath := filepath.Join(t.TempDir(), "jwt.pub")
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	if err := os.WriteFile(pubKeyPath, pubPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privKey, pubKeyPath
 }
@@ -38,6 +38,7 @@ func UserRequired(next http.Handler) http.Handler {
 	return RoleRequired("user")(next)
 }
 
+// RoleRequired limits a request to users with the provided role.
 func RoleRequired(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +53,66 @@ func RoleRequired(role string) func(http.Handler) http.Handler {
 	}
 }
 
+// ScopeRequired limits a request to users that have been granted a scope.
+// Requests without a user are unauthorized; users without the scope, or that do not implement authn.ScopedUser, are forbidden.
+func ScopeRequired(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			user := authn.ForContext(ctx)
+			if user == nil {
+				http.Error(w, makeJsonError(http.StatusText(http.StatusUnauthorized)), http.StatusUnauthorized)
+				return
+			}
+			if su, ok := user.(authn.ScopedUser); !ok || !su.HasScope(scope) {
+				http.Error(w, makeJsonError(http.StatusText(http.StatusForbidden)), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AnyRoleRequired limits a request to users with at least one of the provided roles.
+func AnyRoleRequired(roles ...string) func(http.Handler) http.Handler {
+	return rolesRequired(roles, false)
+}
+
+// AllRolesRequired limits a request to users with every provided role.
+func AllRolesRequired(roles ...string) func(http.Handler) http.Handler {
+	return rolesRequired(roles, true)
+}
+
+func rolesRequired(roles []string, requireAll bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			user := authn.ForContext(ctx)
+			if user == nil || !hasRoles(user, roles, requireAll) {
+				http.Error(w, makeJsonError(http.StatusText(http.StatusUnauthorized)), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasRoles(user authn.User, roles []string, requireAll bool) bool {
+	if len(roles) == 0 {
+		return false
+	}
+	for _, role := range roles {
+		ok := user.HasRole(role)
+		if ok && !requireAll {
+			return true
+		}
+		if !ok && requireAll {
+			return false
+		}
+	}
+	return requireAll
+}
+
 func makeJsonError(msg string) string {
 	a := map[string]string{
 		"error": msg,
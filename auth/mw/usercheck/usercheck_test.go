@@ -13,6 +13,18 @@ func newCtxUser(id string) authn.CtxUser {
 	return authn.NewCtxUser(id, "", "")
 }
 
+// withUser sets a user on the request before running the middleware
+func withUser(user authn.User, mwf func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return NewUserDefaultMiddleware(func() authn.User { return user })(mwf(next))
+	}
+}
+
+// unscopedUser hides the scope methods of a user
+type unscopedUser struct {
+	authn.User
+}
+
 func TestUserMiddleware(t *testing.T) {
 	a := UserDefaultMiddleware("test")
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -79,3 +91,68 @@ func TestAdminRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestAnyRoleRequired(t *testing.T) {
+	tcs := []struct {
+		name string
+		mwf  func(http.Handler) http.Handler
+		code int
+		user authn.User
+	}{
+		{"first role", withUser(newCtxUser("test").WithRoles("a"), AnyRoleRequired("a", "b")), 200, newCtxUser("test").WithRoles("a")},
+		{"second role", withUser(newCtxUser("test").WithRoles("b"), AnyRoleRequired("a", "b")), 200, newCtxUser("test").WithRoles("b")},
+		{"admin", withUser(newCtxUser("test").WithRoles("admin"), AnyRoleRequired("a", "b")), 200, newCtxUser("test").WithRoles("admin")},
+		{"other role", withUser(newCtxUser("test").WithRoles("c"), AnyRoleRequired("a", "b")), 401, nil},
+		{"no roles", withUser(newCtxUser("test").WithRoles("a"), AnyRoleRequired()), 401, nil},
+		{"no user", AnyRoleRequired("a", "b"), 401, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			anchecktest.TestAuthMiddleware(t, req, tc.mwf, tc.code, tc.user)
+		})
+	}
+}
+
+func TestAllRolesRequired(t *testing.T) {
+	tcs := []struct {
+		name string
+		mwf  func(http.Handler) http.Handler
+		code int
+		user authn.User
+	}{
+		{"all roles", withUser(newCtxUser("test").WithRoles("a", "b"), AllRolesRequired("a", "b")), 200, newCtxUser("test").WithRoles("a", "b")},
+		{"admin", withUser(newCtxUser("test").WithRoles("admin"), AllRolesRequired("a", "b")), 200, newCtxUser("test").WithRoles("admin")},
+		{"one role", withUser(newCtxUser("test").WithRoles("a"), AllRolesRequired("a", "b")), 401, nil},
+		{"no roles", withUser(newCtxUser("test").WithRoles("a"), AllRolesRequired()), 401, nil},
+		{"no user", AllRolesRequired("a", "b"), 401, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			anchecktest.TestAuthMiddleware(t, req, tc.mwf, tc.code, tc.user)
+		})
+	}
+}
+
+func TestScopeRequired(t *testing.T) {
+	tcs := []struct {
+		name string
+		mwf  func(http.Handler) http.Handler
+		code int
+		user authn.User
+	}{
+		{"with scope", withUser(newCtxUser("test").WithScopes("feeds:read"), ScopeRequired("feeds:read")), 200, newCtxUser("test").WithScopes("feeds:read")},
+		{"other scope", withUser(newCtxUser("test").WithScopes("feeds:write"), ScopeRequired("feeds:read")), 403, nil},
+		{"role is not scope", withUser(newCtxUser("test").WithRoles("feeds:read"), ScopeRequired("feeds:read")), 403, nil},
+		{"admin", withUser(newCtxUser("test").WithRoles("admin"), ScopeRequired("feeds:read")), 403, nil},
+		{"not scoped user", withUser(unscopedUser{newCtxUser("test").WithScopes("feeds:read")}, ScopeRequired("feeds:read")), 403, nil},
+		{"no user", ScopeRequired("feeds:read"), 401, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			anchecktest.TestAuthMiddleware(t, req, tc.mwf, tc.code, tc.user)
+		})
+	}
+}
@@ -6,60 +6,293 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/interline-io/log"
+	"github.com/xtgo/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrRefreshTimeout is returned when the refresh function does not complete within RefreshTimeout.
+	ErrRefreshTimeout = errors.New("refresh timed out")
+	// ErrNegativeCached is returned for keys with a recent failed load; see NegativeTTL.
+	ErrNegativeCached = errors.New("recent load failed")
 )
 
 type Item[T any] struct {
 	Value     T
 	ExpiresAt time.Time
 	RecheckAt time.Time
+	// Per-key durations; zero values use the cache defaults
+	RecheckTTL time.Duration `json:",omitempty"`
+	ExpiresTTL time.Duration `json:",omitempty"`
 }
 
 type Cache[K comparable, T any] struct {
-	RedisTimeout   time.Duration
+	// KeyFunc converts keys to strings for redis keys and logging.
+	// If nil, keys implementing String() are used directly, and other keys are marshaled to JSON.
+	KeyFunc func(K) (string, error)
+	// RedisTimeout bounds each redis read, write, delete, and publish, so that a slow or
+	// unreachable redis degrades to a local cache miss instead of blocking the caller.
+	// Zero or negative disables the timeout; the caller's context still applies.
+	RedisTimeout time.Duration
+	// RefreshTimeout bounds each call to the refresh function or BatchRefreshFn;
+	// on expiry the refresh context is canceled and ErrRefreshTimeout is returned.
+	// Zero or negative disables the timeout. A caller stops waiting when its own context is done,
+	// but a load shared by concurrent callers is not canceled by any one of them.
 	RefreshTimeout time.Duration
 	Recheck        time.Duration
 	Expires        time.Duration
-	refreshFn      func(context.Context, K) (T, error)
-	topic          string
-	items          map[K]Item[T]
-	lock           sync.Mutex
-	redisClient    *redis.Client
+	// RefreshBackoff is the delay before auto-refresh retries a key that failed to refresh.
+	// The delay doubles with each consecutive failure, up to Recheck.
+	RefreshBackoff time.Duration
+	// MaxRefreshFailures stops auto-refresh for a key after this many consecutive failures;
+	// zero retries indefinitely. The key's value is kept until it expires, and auto-refresh
+	// resumes once the key is successfully loaded again.
+	MaxRefreshFailures int
+	// NegativeTTL is how long Get remembers a failed load for a key and returns a miss
+	// without calling the refresh function again; zero disables negative caching.
+	// Refresh always calls the refresh function.
+	NegativeTTL time.Duration
+	// BatchRefreshFn optionally loads many keys in a single call for GetMany.
+	// Keys missing from the returned map are treated as misses. If nil, GetMany loads keys one at a time.
+	BatchRefreshFn func(context.Context, []K) (map[K]T, error)
+	// Evict optionally selects keys to remove from the local cache during auto-refresh,
+	// e.g. keys that will no longer be read. Evicted keys are not refreshed; values in redis are kept until they expire.
+	// Evict is called with the cache lock held and must not call other cache methods.
+	Evict           func(K) bool
+	refreshFn       func(context.Context, K) (T, error)
+	topic           string
+	items           map[K]Item[T]
+	refreshFailures map[K]refreshFailure
+	negative        map[K]time.Time
+	lock            sync.Mutex
+	redisClient     *redis.Client
+	instanceId      string
+	invalidate      bool
+	stats           cacheCounters
+	done            chan struct{}
+	closeOnce       sync.Once
+	group           singleflight.Group
+}
+
+// CacheStats reports cache effectiveness counters.
+type CacheStats struct {
+	LocalHits       int64
+	RedisHits       int64
+	Misses          int64
+	RefreshOK       int64
+	RefreshTimeouts int64
+	RefreshErrors   int64
+}
+
+type cacheCounters struct {
+	localHits       atomic.Int64
+	redisHits       atomic.Int64
+	misses          atomic.Int64
+	refreshOK       atomic.Int64
+	refreshTimeouts atomic.Int64
+	refreshErrors   atomic.Int64
+}
+
+// refreshFailure tracks consecutive auto-refresh failures for a key
+type refreshFailure struct {
+	count       int
+	nextAttempt time.Time
+}
+
+// invalidateMessage is published when a key is set or deleted
+type invalidateMessage struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
 }
 
 func NewCache[K comparable, T any](refreshFn func(context.Context, K) (T, error), keyPrefix string, redisClient *redis.Client) *Cache[K, T] {
-	topic := "test"
 	rc := Cache[K, T]{
-		refreshFn:      refreshFn,
-		topic:          topic,
-		redisClient:    redisClient,
-		items:          map[K]Item[T]{},
-		Recheck:        1 * time.Hour,
-		Expires:        1 * time.Hour,
-		RefreshTimeout: 1 * time.Second,
-		RedisTimeout:   1 * time.Second,
+		refreshFn:       refreshFn,
+		topic:           keyPrefix,
+		redisClient:     redisClient,
+		items:           map[K]Item[T]{},
+		refreshFailures: map[K]refreshFailure{},
+		negative:        map[K]time.Time{},
+		Recheck:         1 * time.Hour,
+		Expires:         1 * time.Hour,
+		RefreshTimeout:  1 * time.Second,
+		RedisTimeout:    1 * time.Second,
+		RefreshBackoff:  10 * time.Second,
+		instanceId:      uuid.NewRandom().String(),
+		done:            make(chan struct{}),
 	}
 	return &rc
 }
 
+// Close stops the auto-refresh and invalidation goroutines.
+func (rc *Cache[K, T]) Close() error {
+	rc.closeOnce.Do(func() {
+		close(rc.done)
+	})
+	return nil
+}
+
+// StartInvalidation subscribes to invalidation messages from other cache instances
+// sharing the same key prefix, and publishes a message whenever this instance sets or deletes a key.
+// Keys named in messages from other instances are evicted from the local cache.
+// This is opt-in; without it, other instances keep their local values until recheck or expiry.
+// The subscription runs until the context is canceled.
+func (rc *Cache[K, T]) StartInvalidation(ctx context.Context) error {
+	if rc.redisClient == nil {
+		return errors.New("invalidation requires a redis client")
+	}
+	pubsub := rc.redisClient.Subscribe(ctx, rc.invalidateChannel())
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	rc.lock.Lock()
+	rc.invalidate = true
+	rc.lock.Unlock()
+	ch := pubsub.Channel()
+	go func() {
+		defer pubsub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-rc.done:
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				rc.handleInvalidate(msg.Payload)
+			}
+		}
+	}()
+	return nil
+}
+
+func (rc *Cache[K, T]) handleInvalidate(payload string) {
+	msg := invalidateMessage{}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Error().Err(err).Str("topic", rc.topic).Msg("invalidate: failed during unmarshal")
+		return
+	}
+	if msg.Source == rc.instanceId {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	for k := range rc.items {
+		if rc.keyString(k) == msg.Key {
+			log.Trace().Str("key", msg.Key).Msg("invalidate: evicted local key")
+			delete(rc.items, k)
+		}
+	}
+}
+
+// Start begins refreshing keys that are due for recheck. The goroutine runs until Close is called.
+// Keys that fail to refresh are retried with backoff; see RefreshBackoff and MaxRefreshFailures.
 func (rc *Cache[K, T]) Start(t time.Duration) {
 	ticker := time.NewTicker(t)
 	go func() {
-		for t := range ticker.C {
-			_ = t
-			ctx := context.Background()
-			keys := rc.GetRecheckKeys(ctx)
-			for _, key := range keys {
-				rc.Refresh(ctx, key)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rc.done:
+				return
+			case <-ticker.C:
+				rc.autoRefresh(context.Background())
 			}
 		}
 	}()
 }
 
+func (rc *Cache[K, T]) autoRefresh(ctx context.Context) {
+	rc.evictLocal()
+	for _, key := range rc.GetRecheckKeys(ctx) {
+		if !rc.refreshDue(key, time.Now()) {
+			continue
+		}
+		_, err := rc.Refresh(ctx, key)
+		rc.recordRefreshFailure(key, err, time.Now())
+	}
+}
+
+// evictLocal removes keys selected by Evict from the local cache.
+func (rc *Cache[K, T]) evictLocal() {
+	if rc.Evict == nil {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	for key := range rc.items {
+		if !rc.Evict(key) {
+			continue
+		}
+		rc.delLocal(key)
+		delete(rc.refreshFailures, key)
+		delete(rc.negative, key)
+	}
+}
+
+// refreshDue checks if a key is outside its failure backoff and under the failure limit.
+func (rc *Cache[K, T]) refreshDue(key K, now time.Time) bool {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	f, ok := rc.refreshFailures[key]
+	if !ok {
+		return true
+	}
+	if rc.MaxRefreshFailures > 0 && f.count >= rc.MaxRefreshFailures {
+		return false
+	}
+	return !now.Before(f.nextAttempt)
+}
+
+func (rc *Cache[K, T]) recordRefreshFailure(key K, err error, now time.Time) {
+	if err == nil {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	f := rc.refreshFailures[key]
+	f.count += 1
+	delay := rc.RefreshBackoff
+	for i := 1; i < f.count && (rc.Recheck <= 0 || delay < rc.Recheck); i++ {
+		delay *= 2
+	}
+	if rc.Recheck > 0 && delay > rc.Recheck {
+		delay = rc.Recheck
+	}
+	f.nextAttempt = now.Add(delay)
+	rc.refreshFailures[key] = f
+	if rc.MaxRefreshFailures > 0 && f.count >= rc.MaxRefreshFailures {
+		log.Error().Err(err).Str("key", rc.keyString(key)).Int("failures", f.count).Msg("refresh: stopping auto-refresh for key")
+	} else {
+		log.Trace().Str("key", rc.keyString(key)).Int("failures", f.count).Dur("backoff", delay).Msg("refresh: backing off")
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (rc *Cache[K, T]) Stats() CacheStats {
+	return CacheStats{
+		LocalHits:       rc.stats.localHits.Load(),
+		RedisHits:       rc.stats.redisHits.Load(),
+		Misses:          rc.stats.misses.Load(),
+		RefreshOK:       rc.stats.refreshOK.Load(),
+		RefreshTimeouts: rc.stats.refreshTimeouts.Load(),
+		RefreshErrors:   rc.stats.refreshErrors.Load(),
+	}
+}
+
 func (rc *Cache[K, T]) Check(ctx context.Context, key K) (T, bool) {
+	if err := rc.checkKey(key); err != nil {
+		var a T
+		return a, false
+	}
 	rc.lock.Lock()
 	defer rc.lock.Unlock()
 	return rc.check(ctx, key)
@@ -68,21 +301,58 @@ func (rc *Cache[K, T]) Check(ctx context.Context, key K) (T, bool) {
 func (rc *Cache[K, T]) check(ctx context.Context, key K) (T, bool) {
 	a, ok := rc.getLocal(key)
 	if ok {
+		rc.stats.localHits.Add(1)
 		return a.Value, ok
 	}
 	b, ok := rc.getRedis(ctx, key)
 	if ok {
+		rc.stats.redisHits.Add(1)
 		rc.setLocal(key, b)
 	}
 	return b.Value, ok
 }
 
 func (rc *Cache[K, T]) Get(ctx context.Context, key K) (T, bool) {
+	a, err := rc.GetE(ctx, key)
+	return a, err == nil
+}
+
+// GetE is like Get, but returns the reason a value could not be read: the key error,
+// ErrRefreshTimeout, ErrNegativeCached, or the error returned by the refresh function.
+func (rc *Cache[K, T]) GetE(ctx context.Context, key K) (T, error) {
+	if err := rc.checkKey(key); err != nil {
+		var a T
+		return a, err
+	}
 	rc.lock.Lock()
-	defer rc.lock.Unlock()
 	a, ok := rc.check(ctx, key)
+	ttl1, ttl2 := rc.itemTTL(key)
+	rc.lock.Unlock()
+	if ok {
+		return a, nil
+	}
+	rc.stats.misses.Add(1)
+	val, err := rc.loadMiss(ctx, key, ttl1, ttl2)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return val, nil
+}
+
+// GetWithTTL is like Get, but a value loaded on a miss is stored with the provided recheck and expiry durations.
+// These durations are kept with the item and used when it is refreshed.
+func (rc *Cache[K, T]) GetWithTTL(ctx context.Context, key K, ttl1 time.Duration, ttl2 time.Duration) (T, bool) {
+	if err := rc.checkKey(key); err != nil {
+		var a T
+		return a, false
+	}
+	rc.lock.Lock()
+	a, ok := rc.check(ctx, key)
+	rc.lock.Unlock()
 	if !ok {
-		if val, err := rc.refresh(ctx, key); err == nil {
+		rc.stats.misses.Add(1)
+		if val, err := rc.loadMiss(ctx, key, ttl1, ttl2); err == nil {
 			a = val
 			ok = true
 		}
@@ -90,7 +360,93 @@ func (rc *Cache[K, T]) Get(ctx context.Context, key K) (T, bool) {
 	return a, ok
 }
 
+// GetMany reads many keys, loading all misses with a single call to BatchRefreshFn if set.
+// The returned map contains the keys that were read or loaded; the error reports invalid keys and
+// failed loads, and is returned along with any values that were read.
+func (rc *Cache[K, T]) GetMany(ctx context.Context, keys []K) (map[K]T, error) {
+	ret := map[K]T{}
+	var errs []error
+	type miss struct {
+		key        K
+		ttl1, ttl2 time.Duration
+	}
+	var misses []miss
+	seen := map[K]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := rc.checkKey(key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rc.lock.Lock()
+		a, ok := rc.check(ctx, key)
+		ttl1, ttl2 := rc.itemTTL(key)
+		rc.lock.Unlock()
+		if ok {
+			ret[key] = a
+			continue
+		}
+		rc.stats.misses.Add(1)
+		if rc.negativeCached(key) {
+			continue
+		}
+		misses = append(misses, miss{key: key, ttl1: ttl1, ttl2: ttl2})
+	}
+	if len(misses) == 0 {
+		return ret, errors.Join(errs...)
+	}
+	if rc.BatchRefreshFn == nil {
+		for _, m := range misses {
+			a, err := rc.load(ctx, m.key, m.ttl1, m.ttl2)
+			if err != nil {
+				rc.setNegative(ctx, m.key, err)
+				errs = append(errs, err)
+				continue
+			}
+			ret[m.key] = a
+		}
+		return ret, errors.Join(errs...)
+	}
+	missKeys := make([]K, 0, len(misses))
+	for _, m := range misses {
+		missKeys = append(missKeys, m.key)
+	}
+	loaded, err := callRefresh(ctx, rc.RefreshTimeout, &rc.stats, func(ctx context.Context) (map[K]T, error) {
+		return rc.BatchRefreshFn(ctx, missKeys)
+	})
+	if err != nil {
+		log.Error().Err(err).Int("keys", len(missKeys)).Msg("refresh: failed to batch refresh")
+		for _, key := range missKeys {
+			rc.setNegative(ctx, key, err)
+		}
+		errs = append(errs, err)
+		return ret, errors.Join(errs...)
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	for _, m := range misses {
+		a, ok := loaded[m.key]
+		if !ok {
+			continue
+		}
+		if err := rc.setTTL(ctx, m.key, a, m.ttl1, m.ttl2); err != nil {
+			log.Error().Err(err).Str("key", rc.keyString(m.key)).Msg("refresh: failed to set TTL")
+			errs = append(errs, err)
+			continue
+		}
+		rc.stats.refreshOK.Add(1)
+		ret[m.key] = a
+	}
+	return ret, errors.Join(errs...)
+}
+
 func (rc *Cache[K, T]) SetTTL(ctx context.Context, key K, value T, ttl1 time.Duration, ttl2 time.Duration) error {
+	if err := rc.checkKey(key); err != nil {
+		return err
+	}
 	rc.lock.Lock()
 	defer rc.lock.Unlock()
 	return rc.setTTL(ctx, key, value, ttl1, ttl2)
@@ -103,11 +459,64 @@ func (rc *Cache[K, T]) setTTL(ctx context.Context, key K, value T, ttl1 time.Dur
 		RecheckAt: n.Add(ttl1),
 		ExpiresAt: n.Add(ttl2),
 	}
+	if ttl1 != rc.Recheck {
+		item.RecheckTTL = ttl1
+	}
+	if ttl2 != rc.Expires {
+		item.ExpiresTTL = ttl2
+	}
 	rc.setLocal(key, item)
 	rc.setRedis(ctx, key, item)
+	rc.publishInvalidate(ctx, key)
+	delete(rc.refreshFailures, key)
+	delete(rc.negative, key)
 	return nil
 }
 
+// Delete removes a key from the local and redis caches.
+func (rc *Cache[K, T]) Delete(ctx context.Context, key K) error {
+	if err := rc.checkKey(key); err != nil {
+		return err
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	rc.delLocal(key)
+	delete(rc.refreshFailures, key)
+	delete(rc.negative, key)
+	err := rc.delRedis(ctx, key)
+	rc.publishInvalidate(ctx, key)
+	return err
+}
+
+// Update applies fn to a locally cached value, keeping the existing recheck and expiry times.
+// The value in redis is not changed, so other instances keep their values until the key is refreshed.
+// Returns false if the key is not present in the local cache.
+func (rc *Cache[K, T]) Update(key K, fn func(T) T) bool {
+	if err := rc.checkKey(key); err != nil {
+		return false
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	item, ok := rc.getLocal(key)
+	if !ok {
+		return false
+	}
+	item.Value = fn(item.Value)
+	rc.setLocal(key, item)
+	return true
+}
+
+// LocalKeys returns the keys currently held in the local cache.
+func (rc *Cache[K, T]) LocalKeys() []K {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	var ret []K
+	for k := range rc.items {
+		ret = append(ret, k)
+	}
+	return ret
+}
+
 func (rc *Cache[K, T]) GetRecheckKeys(ctx context.Context) []K {
 	rc.lock.Lock()
 	defer rc.lock.Unlock()
@@ -133,46 +542,153 @@ func (rc *Cache[K, T]) GetRecheckKeys(ctx context.Context) []K {
 }
 
 func (rc *Cache[K, T]) Refresh(ctx context.Context, key K) (T, error) {
+	if err := rc.checkKey(key); err != nil {
+		var a T
+		return a, err
+	}
+	rc.lock.Lock()
+	ttl1, ttl2 := rc.itemTTL(key)
+	rc.lock.Unlock()
+	return rc.load(ctx, key, ttl1, ttl2)
+}
+
+// load runs the refresh function without holding the cache lock.
+// Concurrent loads for the same key share a single call to the refresh function.
+// The shared call is bounded by RefreshTimeout but is not canceled by any one caller;
+// each caller stops waiting when its own context is done.
+func (rc *Cache[K, T]) load(ctx context.Context, key K, ttl1 time.Duration, ttl2 time.Duration) (T, error) {
+	kstr := rc.keyString(key)
+	ch := rc.group.DoChan(kstr, func() (any, error) {
+		return rc.refreshTTL(context.WithoutCancel(ctx), key, ttl1, ttl2)
+	})
+	select {
+	case <-ctx.Done():
+		var a T
+		return a, ctx.Err()
+	case ret := <-ch:
+		if ret.Shared {
+			log.Trace().Str("key", kstr).Msg("refresh: shared result")
+		}
+		item, _ := ret.Val.(T)
+		return item, ret.Err
+	}
+}
+
+// loadMiss loads a key after a cache miss, consulting and updating the negative cache.
+func (rc *Cache[K, T]) loadMiss(ctx context.Context, key K, ttl1 time.Duration, ttl2 time.Duration) (T, error) {
+	if rc.negativeCached(key) {
+		var a T
+		return a, ErrNegativeCached
+	}
+	a, err := rc.load(ctx, key, ttl1, ttl2)
+	if err != nil {
+		rc.setNegative(ctx, key, err)
+	}
+	return a, err
+}
+
+// negativeCached checks if a key has a recent failed load.
+func (rc *Cache[K, T]) negativeCached(key K) bool {
+	if rc.NegativeTTL <= 0 {
+		return false
+	}
 	rc.lock.Lock()
 	defer rc.lock.Unlock()
-	return rc.refresh(ctx, key)
+	until, ok := rc.negative[key]
+	if ok && !time.Now().Before(until) {
+		delete(rc.negative, key)
+		ok = false
+	}
+	return ok
 }
 
-func (rc *Cache[K, T]) refresh(ctx context.Context, key K) (T, error) {
-	kstr := toString(key)
-	type rt struct {
-		item T
-		err  error
+// setNegative remembers a failed load for a key.
+func (rc *Cache[K, T]) setNegative(ctx context.Context, key K, err error) {
+	// Do not remember failures caused by the caller canceling the request or its deadline
+	if rc.NegativeTTL <= 0 || ctx.Err() != nil {
+		return
 	}
-	result := make(chan rt, 1)
-	go func(ctx context.Context, key K) {
-		item, err := rc.refreshFn(ctx, key)
-		result <- rt{item: item, err: err}
-	}(ctx, key)
-	var err error
-	var item T
-	select {
-	case <-time.After(rc.RefreshTimeout):
-		err = errors.New("timed out")
-	case ret := <-result:
-		err = ret.err
-		item = ret.item
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	rc.lock.Lock()
+	rc.negative[key] = time.Now().Add(rc.NegativeTTL)
+	rc.lock.Unlock()
+}
+
+// itemTTL returns the recheck and expiry durations for a key,
+// preferring per-key durations stored with an existing item.
+func (rc *Cache[K, T]) itemTTL(key K) (time.Duration, time.Duration) {
+	ttl1, ttl2 := rc.Recheck, rc.Expires
+	if item, ok := rc.items[key]; ok {
+		if item.RecheckTTL > 0 {
+			ttl1 = item.RecheckTTL
+		}
+		if item.ExpiresTTL > 0 {
+			ttl2 = item.ExpiresTTL
+		}
 	}
+	return ttl1, ttl2
+}
+
+func (rc *Cache[K, T]) refreshTTL(ctx context.Context, key K, ttl1 time.Duration, ttl2 time.Duration) (T, error) {
+	kstr := rc.keyString(key)
+	item, err := callRefresh(ctx, rc.RefreshTimeout, &rc.stats, func(ctx context.Context) (T, error) {
+		return rc.refreshFn(ctx, key)
+	})
 	if err != nil {
 		log.Error().Err(err).Str("key", kstr).Msg("refresh: failed to refresh")
 		return item, err
 	}
-	err = rc.setTTL(ctx, key, item, rc.Recheck, rc.Expires)
+	rc.lock.Lock()
+	err = rc.setTTL(ctx, key, item, ttl1, ttl2)
+	rc.lock.Unlock()
 	if err != nil {
 		log.Error().Err(err).Str("key", kstr).Msg("refresh: failed to set TTL")
 		return item, err
 	}
+	rc.stats.refreshOK.Add(1)
 	log.Trace().Str("key", kstr).Msg("refresh: ok")
 	return item, nil
 }
 
+// callRefresh runs a refresh function, returning when it completes, the timeout expires, or the caller's context is done.
+// The refresh function's context is canceled on return.
+func callRefresh[R any](ctx context.Context, timeout time.Duration, stats *cacheCounters, fn func(context.Context) (R, error)) (R, error) {
+	type rt struct {
+		item R
+		err  error
+	}
+	rctx, cc := withTimeout(ctx, timeout)
+	defer cc()
+	result := make(chan rt, 1)
+	go func() {
+		item, err := fn(rctx)
+		result <- rt{item: item, err: err}
+	}()
+	var err error
+	var item R
+	select {
+	case <-rctx.Done():
+		err = rctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			stats.refreshTimeouts.Add(1)
+			err = ErrRefreshTimeout
+		} else {
+			stats.refreshErrors.Add(1)
+		}
+	case ret := <-result:
+		err = ret.err
+		item = ret.item
+		if err != nil {
+			stats.refreshErrors.Add(1)
+		}
+	}
+	return item, err
+}
+
 func (rc *Cache[K, T]) getLocal(key K) (Item[T], bool) {
-	kstr := toString(key)
+	kstr := rc.keyString(key)
 	log.Trace().Str("key", kstr).Msg("local read: start")
 	a, ok := rc.items[key]
 	if !ok {
@@ -187,6 +703,14 @@ func (rc *Cache[K, T]) getLocal(key K) (Item[T], bool) {
 	return a, ok
 }
 
+// withTimeout returns a context with the timeout applied, or without a deadline if the timeout is not positive.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
 func (rc *Cache[K, T]) getRedis(ctx context.Context, key K) (Item[T], bool) {
 	ekey := rc.redisKey(key)
 	log.Trace().Str("key", ekey).Msg("redis read: start")
@@ -194,7 +718,7 @@ func (rc *Cache[K, T]) getRedis(ctx context.Context, key K) (Item[T], bool) {
 		log.Trace().Str("key", ekey).Msg("redis read: no redis client")
 		return Item[T]{}, false
 	}
-	rctx, cc := context.WithTimeout(ctx, rc.RedisTimeout)
+	rctx, cc := withTimeout(ctx, rc.RedisTimeout)
 	defer cc()
 	lastData := rc.redisClient.Get(rctx, ekey)
 	if err := lastData.Err(); err != nil {
@@ -223,7 +747,7 @@ func (rc *Cache[K, T]) getRedis(ctx context.Context, key K) (Item[T], bool) {
 }
 
 func (rc *Cache[K, T]) setLocal(key K, item Item[T]) error {
-	kstr := toString(key)
+	kstr := rc.keyString(key)
 	log.Trace().Str("key", kstr).Msg("local write: ok")
 	rc.items[key] = item
 	return nil
@@ -236,7 +760,7 @@ func (rc *Cache[K, T]) setRedis(ctx context.Context, key K, item Item[T]) error
 		log.Trace().Str("key", ekey).Msg("redis write: no redis client")
 		return nil
 	}
-	rctx, cc := context.WithTimeout(ctx, rc.RedisTimeout)
+	rctx, cc := withTimeout(ctx, rc.RedisTimeout)
 	defer cc()
 	data, err := json.Marshal(item)
 	if err != nil {
@@ -244,15 +768,65 @@ func (rc *Cache[K, T]) setRedis(ctx context.Context, key K, item Item[T]) error
 		return err
 	}
 	log.Trace().Str("key", ekey).Str("data", string(data)).Msg("redis write: data")
-	if err := rc.redisClient.Set(rctx, ekey, data, rc.Expires).Err(); err != nil {
+	expires := rc.Expires
+	if item.ExpiresTTL > 0 {
+		expires = item.ExpiresTTL
+	}
+	if err := rc.redisClient.Set(rctx, ekey, data, expires).Err(); err != nil {
 		log.Error().Err(err).Str("key", ekey).Msg("redis write: failed")
 	}
 	log.Trace().Str("key", ekey).Msg("redis write: ok")
 	return nil
 }
 
+func (rc *Cache[K, T]) delLocal(key K) {
+	kstr := rc.keyString(key)
+	log.Trace().Str("key", kstr).Msg("local delete: ok")
+	delete(rc.items, key)
+}
+
+func (rc *Cache[K, T]) delRedis(ctx context.Context, key K) error {
+	ekey := rc.redisKey(key)
+	log.Trace().Str("key", ekey).Msg("redis delete: start")
+	if rc.redisClient == nil {
+		log.Trace().Str("key", ekey).Msg("redis delete: no redis client")
+		return nil
+	}
+	rctx, cc := withTimeout(ctx, rc.RedisTimeout)
+	defer cc()
+	if err := rc.redisClient.Del(rctx, ekey).Err(); err != nil {
+		log.Error().Err(err).Str("key", ekey).Msg("redis delete: failed")
+		return err
+	}
+	log.Trace().Str("key", ekey).Msg("redis delete: ok")
+	return nil
+}
+
+func (rc *Cache[K, T]) publishInvalidate(ctx context.Context, key K) error {
+	if !rc.invalidate || rc.redisClient == nil {
+		return nil
+	}
+	kstr := rc.keyString(key)
+	data, err := json.Marshal(invalidateMessage{Source: rc.instanceId, Key: kstr})
+	if err != nil {
+		return err
+	}
+	rctx, cc := withTimeout(ctx, rc.RedisTimeout)
+	defer cc()
+	if err := rc.redisClient.Publish(rctx, rc.invalidateChannel(), data).Err(); err != nil {
+		log.Error().Err(err).Str("key", kstr).Msg("invalidate: publish failed")
+		return err
+	}
+	log.Trace().Str("key", kstr).Msg("invalidate: publish ok")
+	return nil
+}
+
+func (rc *Cache[K, T]) invalidateChannel() string {
+	return fmt.Sprintf("ecache:%s:invalidate", rc.topic)
+}
+
 func (rc *Cache[K, T]) redisKey(key K) string {
-	kstr := toString(key)
+	kstr := rc.keyString(key)
 	return fmt.Sprintf("ecache:%s:%s", rc.topic, kstr)
 }
 
@@ -260,13 +834,35 @@ type canString interface {
 	String() string
 }
 
-func toString(item any) string {
+// checkKey returns an error if the key cannot be converted to a string.
+func (rc *Cache[K, T]) checkKey(key K) error {
+	_, err := rc.keyStringE(key)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid cache key")
+	}
+	return err
+}
+
+// keyString returns the string form of a key; keys should be checked with checkKey first.
+func (rc *Cache[K, T]) keyString(key K) string {
+	kstr, _ := rc.keyStringE(key)
+	return kstr
+}
+
+func (rc *Cache[K, T]) keyStringE(key K) (string, error) {
+	if rc.KeyFunc != nil {
+		return rc.KeyFunc(key)
+	}
+	return toString(key)
+}
+
+func toString(item any) (string, error) {
 	if v, ok := item.(canString); ok {
-		return v.String()
+		return v.String(), nil
 	}
 	data, err := json.Marshal(item)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(data)
+	return string(data), nil
 }
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/interline-io/transitland-dbutil/testutil"
 	"github.com/stretchr/testify/assert"
 )
@@ -172,6 +177,65 @@ func TestCache(t *testing.T) {
 		}
 	})
 
+	t.Run("delete", func(t *testing.T) {
+		key := testKey()
+		rc := NewCache[rcTestKey, rcTestItem](retKey, pfx(), redisClient)
+		if _, ok := rc.Get(context.Background(), key); !ok {
+			t.Error("expected ok read")
+		}
+		if err := rc.Delete(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rc.getLocal(key); ok {
+			t.Error("expected failed local read")
+		}
+		if _, ok := rc.getRedis(context.Background(), key); ok {
+			t.Error("expected failed redis read")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		key := testKey()
+		ctx, cc := context.WithCancel(context.Background())
+		defer cc()
+		topic := pfx()
+		rc1 := NewCache[rcTestKey, rcTestItem](retKey, topic, redisClient)
+		rc2 := NewCache[rcTestKey, rcTestItem](retKey, topic, redisClient)
+		if err := rc1.StartInvalidation(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc2.StartInvalidation(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// Load into both local caches
+		if a, ok := rc1.Get(ctx, key); !ok || a.Value != key.Key {
+			t.Error("expected ok read")
+		}
+		if a, ok := rc2.Get(ctx, key); !ok || a.Value != key.Key {
+			t.Error("expected ok read")
+		}
+
+		// Set on one instance; other instance should drop its local value
+		rc1.SetTTL(ctx, key, rcTestItem{Value: "updated"}, time.Hour, time.Hour)
+		time.Sleep(100 * time.Millisecond)
+		if a, ok := rc1.getLocal(key); !ok || a.Value.Value != "updated" {
+			t.Error("expected local value to be kept on publishing instance")
+		}
+		if a, ok := rc2.Check(ctx, key); ok {
+			assert.Equal(t, "updated", a.Value)
+		} else {
+			t.Error("expected ok read")
+		}
+
+		// Delete on one instance
+		rc2.Delete(ctx, key)
+		time.Sleep(100 * time.Millisecond)
+		if _, ok := rc1.Check(ctx, key); ok {
+			t.Error("expected failed read")
+		}
+	})
+
 	t.Run("recheck", func(t *testing.T) {
 		key := testKey()
 		// Set refresh interval to 1 second
@@ -200,3 +264,574 @@ func TestCache(t *testing.T) {
 	})
 
 }
+
+func TestCache_Refresh(t *testing.T) {
+	key := rcTestKey{Key: "test"}
+	t.Run("timeout cancels refresh", func(t *testing.T) {
+		canceled := make(chan bool, 1)
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			select {
+			case <-ctx.Done():
+				canceled <- true
+				return rcTestItem{}, ctx.Err()
+			case <-time.After(5 * time.Second):
+				canceled <- false
+			}
+			return rcTestItem{key.Key}, nil
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.RefreshTimeout = 100 * time.Millisecond
+		if _, err := rc.Refresh(context.Background(), key); err == nil {
+			t.Error("expected error")
+		}
+		assert.True(t, <-canceled, "expected refresh context to be canceled")
+	})
+	t.Run("caller context canceled", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			<-ctx.Done()
+			return rcTestItem{}, ctx.Err()
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.RefreshTimeout = 10 * time.Second
+		ctx, cc := context.WithCancel(context.Background())
+		cc()
+		_, err := rc.Refresh(ctx, key)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("ok", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			return rcTestItem{key.Key}, nil
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		a, err := rc.Refresh(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Key, a.Value)
+		if a, ok := rc.Check(context.Background(), key); ok {
+			assert.Equal(t, key.Key, a.Value)
+		} else {
+			t.Error("expected ok read")
+		}
+	})
+}
+
+func TestCache_AutoRefreshBackoff(t *testing.T) {
+	key := rcTestKey{Key: "test"}
+	fail := true
+	calls := 0
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		calls += 1
+		if fail {
+			return rcTestItem{}, errors.New("fail")
+		}
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.Recheck = 0
+	rc.RefreshBackoff = 50 * time.Millisecond
+	rc.MaxRefreshFailures = 2
+	ctx := context.Background()
+	assert.NoError(t, rc.SetTTL(ctx, key, rcTestItem{key.Key}, 0, time.Hour))
+
+	// First failure starts backoff
+	rc.autoRefresh(ctx)
+	assert.Equal(t, 1, calls)
+	rc.autoRefresh(ctx)
+	assert.Equal(t, 1, calls, "expected key to be skipped during backoff")
+
+	// Second failure stops auto-refresh but keeps the value
+	time.Sleep(60 * time.Millisecond)
+	rc.autoRefresh(ctx)
+	assert.Equal(t, 2, calls)
+	time.Sleep(150 * time.Millisecond)
+	rc.autoRefresh(ctx)
+	assert.Equal(t, 2, calls, "expected key to be dropped from auto-refresh")
+	_, ok := rc.Check(ctx, key)
+	assert.True(t, ok)
+
+	// Explicit refresh resumes auto-refresh
+	fail = false
+	_, err := rc.Refresh(ctx, key)
+	assert.NoError(t, err)
+	rc.autoRefresh(ctx)
+	assert.Equal(t, 4, calls)
+}
+
+func TestCache_NegativeTTL(t *testing.T) {
+	key := rcTestKey{Key: "test"}
+	fail := true
+	calls := 0
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		calls += 1
+		if fail {
+			return rcTestItem{}, errors.New("not found")
+		}
+		return rcTestItem{key.Key}, nil
+	}
+	ctx := context.Background()
+	t.Run("disabled", func(t *testing.T) {
+		calls = 0
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		for i := 0; i < 3; i++ {
+			_, ok := rc.Get(ctx, key)
+			assert.False(t, ok)
+		}
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("enabled", func(t *testing.T) {
+		calls = 0
+		fail = true
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.NegativeTTL = 50 * time.Millisecond
+		for i := 0; i < 3; i++ {
+			_, ok := rc.Get(ctx, key)
+			assert.False(t, ok)
+		}
+		assert.Equal(t, 1, calls, "expected failure to be remembered")
+		time.Sleep(60 * time.Millisecond)
+		fail = false
+		a, ok := rc.Get(ctx, key)
+		assert.True(t, ok)
+		assert.Equal(t, key.Key, a.Value)
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("refresh bypasses", func(t *testing.T) {
+		calls = 0
+		fail = true
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.NegativeTTL = time.Hour
+		_, ok := rc.Get(ctx, key)
+		assert.False(t, ok)
+		fail = false
+		_, err := rc.Refresh(ctx, key)
+		assert.NoError(t, err)
+		_, ok = rc.Get(ctx, key)
+		assert.True(t, ok)
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestCache_GetE(t *testing.T) {
+	ctx := context.Background()
+	key := rcTestKey{Key: "test"}
+	errLoad := errors.New("backend unavailable")
+	t.Run("ok", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			return rcTestItem{key.Key}, nil
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		a, err := rc.GetE(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Key, a.Value)
+	})
+	t.Run("loader error", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			return rcTestItem{key.Key}, errLoad
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		a, err := rc.GetE(ctx, key)
+		assert.ErrorIs(t, err, errLoad)
+		assert.Equal(t, rcTestItem{}, a)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			<-ctx.Done()
+			return rcTestItem{}, ctx.Err()
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.RefreshTimeout = 10 * time.Millisecond
+		_, err := rc.GetE(ctx, key)
+		assert.ErrorIs(t, err, ErrRefreshTimeout)
+	})
+	t.Run("negative cached", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+			return rcTestItem{}, errLoad
+		}
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.NegativeTTL = time.Hour
+		_, err := rc.GetE(ctx, key)
+		assert.ErrorIs(t, err, errLoad)
+		_, err = rc.GetE(ctx, key)
+		assert.ErrorIs(t, err, ErrNegativeCached)
+	})
+}
+
+func TestCache_RedisTimeout(t *testing.T) {
+	// Accept connections but never respond, simulating a hung redis
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	client := redis.NewClient(&redis.Options{
+		Addr:        ln.Addr().String(),
+		ReadTimeout: -1,
+		MaxRetries:  -1,
+	})
+	defer client.Close()
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", client)
+	rc.RedisTimeout = 50 * time.Millisecond
+	key := rcTestKey{Key: "test"}
+	ctx := context.Background()
+	start := time.Now()
+	_, ok := rc.Check(ctx, key)
+	assert.False(t, ok)
+	a, ok := rc.Get(ctx, key)
+	assert.True(t, ok)
+	assert.Equal(t, key.Key, a.Value)
+	assert.Less(t, time.Since(start), 2*time.Second, "expected redis calls to be bounded by RedisTimeout")
+}
+
+func TestCache_GetMany(t *testing.T) {
+	ctx := context.Background()
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		if key.Key == "bad" {
+			return rcTestItem{}, errors.New("not found")
+		}
+		return rcTestItem{key.Key}, nil
+	}
+	keys := []rcTestKey{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "a"}}
+	t.Run("batch", func(t *testing.T) {
+		var batches [][]rcTestKey
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.BatchRefreshFn = func(ctx context.Context, keys []rcTestKey) (map[rcTestKey]rcTestItem, error) {
+			batches = append(batches, keys)
+			ret := map[rcTestKey]rcTestItem{}
+			for _, key := range keys {
+				if key.Key != "c" {
+					ret[key] = rcTestItem{key.Key}
+				}
+			}
+			return ret, nil
+		}
+		assert.NoError(t, rc.SetTTL(ctx, rcTestKey{Key: "a"}, rcTestItem{"a"}, time.Hour, time.Hour))
+		ret, err := rc.GetMany(ctx, keys)
+		assert.NoError(t, err)
+		assert.Equal(t, map[rcTestKey]rcTestItem{{Key: "a"}: {"a"}, {Key: "b"}: {"b"}}, ret)
+		assert.Equal(t, [][]rcTestKey{{{Key: "b"}, {Key: "c"}}}, batches)
+		// Loaded values are cached
+		a, ok := rc.Check(ctx, rcTestKey{Key: "b"})
+		assert.True(t, ok)
+		assert.Equal(t, "b", a.Value)
+	})
+	t.Run("batch error", func(t *testing.T) {
+		errBatch := errors.New("batch failed")
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		rc.BatchRefreshFn = func(ctx context.Context, keys []rcTestKey) (map[rcTestKey]rcTestItem, error) {
+			return nil, errBatch
+		}
+		assert.NoError(t, rc.SetTTL(ctx, rcTestKey{Key: "a"}, rcTestItem{"a"}, time.Hour, time.Hour))
+		ret, err := rc.GetMany(ctx, keys)
+		assert.ErrorIs(t, err, errBatch)
+		assert.Equal(t, map[rcTestKey]rcTestItem{{Key: "a"}: {"a"}}, ret)
+	})
+	t.Run("per key", func(t *testing.T) {
+		rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+		ret, err := rc.GetMany(ctx, []rcTestKey{{Key: "a"}, {Key: "bad"}})
+		assert.Error(t, err)
+		assert.Equal(t, map[rcTestKey]rcTestItem{{Key: "a"}: {"a"}}, ret)
+	})
+}
+
+func TestCache_RedisKey(t *testing.T) {
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc1 := NewCache[rcTestKey, rcTestItem](refreshFn, "a", nil)
+	rc2 := NewCache[rcTestKey, rcTestItem](refreshFn, "b", nil)
+	key := rcTestKey{Key: "test", Time: 1}
+	assert.Equal(t, "ecache:a:test:1", rc1.redisKey(key))
+	assert.NotEqual(t, rc1.redisKey(key), rc2.redisKey(key))
+}
+
+func TestCache_Delete(t *testing.T) {
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	key := rcTestKey{Key: "test", Time: 1}
+	if _, ok := rc.Get(context.Background(), key); !ok {
+		t.Error("expected ok read")
+	}
+	assert.Equal(t, []rcTestKey{key}, rc.LocalKeys())
+	if err := rc.Delete(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.Check(context.Background(), key); ok {
+		t.Error("expected failed read")
+	}
+	assert.Equal(t, 0, len(rc.LocalKeys()))
+}
+
+func TestCache_Evict(t *testing.T) {
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.Evict = func(key rcTestKey) bool {
+		return key.Time < 2
+	}
+	ctx := context.Background()
+	key1 := rcTestKey{Key: "test", Time: 1}
+	key2 := rcTestKey{Key: "test", Time: 2}
+	rc.Get(ctx, key1)
+	rc.Get(ctx, key2)
+	assert.Equal(t, 2, len(rc.LocalKeys()))
+	rc.autoRefresh(ctx)
+	assert.Equal(t, []rcTestKey{key2}, rc.LocalKeys())
+}
+
+func TestCache_StartInvalidation(t *testing.T) {
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	if err := rc.StartInvalidation(context.Background()); err == nil {
+		t.Error("expected error without redis client")
+	}
+	// Messages from other instances evict the local key
+	key := rcTestKey{Key: "test", Time: 1}
+	rc.Get(context.Background(), key)
+	rc.handleInvalidate(`{"source":"` + rc.instanceId + `","key":"test:1"}`)
+	assert.Equal(t, 1, len(rc.LocalKeys()))
+	rc.handleInvalidate(`{"source":"other","key":"test:1"}`)
+	assert.Equal(t, 0, len(rc.LocalKeys()))
+}
+
+func TestCache_Stats(t *testing.T) {
+	ctx := context.Background()
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		if key.Key == "fail" {
+			return rcTestItem{}, errors.New("fail")
+		}
+		if key.Key == "slow" {
+			<-ctx.Done()
+			return rcTestItem{}, ctx.Err()
+		}
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.RefreshTimeout = 100 * time.Millisecond
+	rc.Get(ctx, rcTestKey{Key: "ok"})
+	rc.Get(ctx, rcTestKey{Key: "ok"})
+	rc.Get(ctx, rcTestKey{Key: "ok"})
+	rc.Get(ctx, rcTestKey{Key: "fail"})
+	rc.Get(ctx, rcTestKey{Key: "slow"})
+	rc.Refresh(ctx, rcTestKey{Key: "ok"})
+	assert.Equal(t, CacheStats{
+		LocalHits:       2,
+		RedisHits:       0,
+		Misses:          3,
+		RefreshOK:       2,
+		RefreshTimeouts: 1,
+		RefreshErrors:   1,
+	}, rc.Stats())
+}
+
+func TestCache_GetWithTTL(t *testing.T) {
+	ctx := context.Background()
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.Recheck = time.Hour
+	rc.Expires = time.Hour
+	key := rcTestKey{Key: "short"}
+	defaultKey := rcTestKey{Key: "default"}
+	if _, ok := rc.GetWithTTL(ctx, key, 1*time.Second, 2*time.Second); !ok {
+		t.Fatal("expected ok read")
+	}
+	if _, ok := rc.Get(ctx, defaultKey); !ok {
+		t.Fatal("expected ok read")
+	}
+	checkTTL := func(k rcTestKey, recheck time.Duration, expires time.Duration) {
+		item, ok := rc.getLocal(k)
+		if !ok {
+			t.Fatal("expected ok read")
+		}
+		assert.WithinDuration(t, time.Now().Add(recheck), item.RecheckAt, 100*time.Millisecond)
+		assert.WithinDuration(t, time.Now().Add(expires), item.ExpiresAt, 100*time.Millisecond)
+	}
+	checkTTL(key, 1*time.Second, 2*time.Second)
+	checkTTL(defaultKey, time.Hour, time.Hour)
+
+	// Per-key TTL is kept on refresh
+	if _, err := rc.Refresh(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	checkTTL(key, 1*time.Second, 2*time.Second)
+	if _, err := rc.Refresh(ctx, defaultKey); err != nil {
+		t.Fatal(err)
+	}
+	checkTTL(defaultKey, time.Hour, time.Hour)
+
+	// Expires
+	time.Sleep(2100 * time.Millisecond)
+	if _, ok := rc.Check(ctx, key); ok {
+		t.Error("expected failed read")
+	}
+	if _, ok := rc.Check(ctx, defaultKey); !ok {
+		t.Error("expected ok read")
+	}
+}
+
+func TestCache_Close(t *testing.T) {
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		return rcTestItem{key.Key}, nil
+	}
+	waitGoroutines := func(n int) int {
+		for i := 0; i < 100; i++ {
+			if runtime.NumGoroutine() <= n {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return runtime.NumGoroutine()
+	}
+	before := waitGoroutines(0)
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.Start(10 * time.Millisecond)
+	assert.Greater(t, runtime.NumGoroutine(), before)
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assert.LessOrEqual(t, waitGoroutines(before), before, "expected no lingering goroutines")
+	// Close is idempotent
+	assert.NoError(t, rc.Close())
+}
+
+func TestCache_Singleflight(t *testing.T) {
+	var calls atomic.Int64
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		calls.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	key := rcTestKey{Key: "test"}
+	otherKey := rcTestKey{Key: "other"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a, ok := rc.Get(context.Background(), key); ok {
+				assert.Equal(t, key.Key, a.Value)
+			} else {
+				t.Error("expected ok read")
+			}
+		}()
+	}
+	// Other keys are not blocked by an in-flight load
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, ok := rc.Get(context.Background(), otherKey); !ok {
+			t.Error("expected ok read")
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, int64(2), calls.Load())
+}
+
+func TestCache_SingleflightCallerCanceled(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	var calls atomic.Int64
+	refreshFn := func(ctx context.Context, key rcTestKey) (rcTestItem, error) {
+		if calls.Add(1) == 1 {
+			started <- true
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return rcTestItem{}, ctx.Err()
+		}
+		return rcTestItem{key.Key}, nil
+	}
+	rc := NewCache[rcTestKey, rcTestItem](refreshFn, "test", nil)
+	rc.NegativeTTL = time.Hour
+	key := rcTestKey{Key: "test"}
+
+	// Caller A starts the load, caller B joins it
+	ctxA, cancelA := context.WithCancel(context.Background())
+	errA := make(chan error, 1)
+	go func() {
+		_, err := rc.GetE(ctxA, key)
+		errA <- err
+	}()
+	<-started
+	resultB := make(chan rcTestItem, 1)
+	go func() {
+		a, err := rc.GetE(context.Background(), key)
+		assert.NoError(t, err)
+		resultB <- a
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Canceling A does not cancel the shared load for B
+	cancelA()
+	assert.ErrorIs(t, <-errA, context.Canceled)
+	close(release)
+	assert.Equal(t, key.Key, (<-resultB).Value)
+
+	// The cancellation was not negatively cached
+	a, err := rc.GetE(context.Background(), key)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Key, a.Value)
+	assert.Equal(t, int64(1), calls.Load())
+}
+
+type rcBadKey struct {
+	Key string
+	Ch  chan int
+}
+
+func TestCache_KeyFunc(t *testing.T) {
+	ctx := context.Background()
+	t.Run("unmarshalable key", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcBadKey) (rcTestItem, error) {
+			return rcTestItem{key.Key}, nil
+		}
+		rc := NewCache[rcBadKey, rcTestItem](refreshFn, "test", nil)
+		key := rcBadKey{Key: "test"}
+		if _, ok := rc.Get(ctx, key); ok {
+			t.Error("expected failed read")
+		}
+		if _, ok := rc.Check(ctx, key); ok {
+			t.Error("expected failed read")
+		}
+		if _, err := rc.Refresh(ctx, key); err == nil {
+			t.Error("expected error")
+		}
+		assert.Error(t, rc.SetTTL(ctx, key, rcTestItem{}, time.Hour, time.Hour))
+		assert.Error(t, rc.Delete(ctx, key))
+	})
+	t.Run("custom key func", func(t *testing.T) {
+		refreshFn := func(ctx context.Context, key rcBadKey) (rcTestItem, error) {
+			return rcTestItem{key.Key}, nil
+		}
+		rc := NewCache[rcBadKey, rcTestItem](refreshFn, "test", nil)
+		rc.KeyFunc = func(k rcBadKey) (string, error) {
+			return k.Key, nil
+		}
+		key := rcBadKey{Key: "test"}
+		if a, ok := rc.Get(ctx, key); ok {
+			assert.Equal(t, key.Key, a.Value)
+		} else {
+			t.Error("expected ok read")
+		}
+		assert.Equal(t, "ecache:test:test", rc.redisKey(key))
+	})
+}
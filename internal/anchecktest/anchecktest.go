@@ -27,6 +27,12 @@ func TestAuthMiddleware(t *testing.T, req *http.Request, mwf func(http.Handler)
 		for _, checkRole := range expectUser.Roles() {
 			assert.Equalf(t, true, user.HasRole(checkRole), "checking role '%s'", checkRole)
 		}
+		if expectScoped, ok := expectUser.(authn.ScopedUser); ok {
+			scoped, _ := user.(authn.ScopedUser)
+			for _, checkScope := range expectScoped.Scopes() {
+				assert.Equalf(t, true, scoped != nil && scoped.HasScope(checkScope), "checking scope '%s'", checkScope)
+			}
+		}
 	} else if expectUser == nil && user != nil {
 		t.Errorf("got user, expected none")
 	} else if expectUser != nil && user == nil {
@@ -1,6 +1,7 @@
 package metertest
 
 import (
+	"context"
 	"testing"
 
 	"github.com/interline-io/transitland-mw/meters"
@@ -35,6 +36,24 @@ func (u TestUser) GetExternalData(key string) (string, bool) {
 	return a, ok
 }
 
+// ContextProvider records calls to FlushContext and CloseContext,
+// for checking that wrapping providers pass them through.
+type ContextProvider struct {
+	FlushedContext bool
+	ClosedContext  bool
+	MeterProvider
+}
+
+func (m *ContextProvider) FlushContext(ctx context.Context) error {
+	m.FlushedContext = true
+	return m.MeterProvider.Flush()
+}
+
+func (m *ContextProvider) CloseContext(ctx context.Context) error {
+	m.ClosedContext = true
+	return m.MeterProvider.Close()
+}
+
 type Config struct {
 	TestMeter1 string
 	TestMeter2 string
@@ -136,4 +155,15 @@ func TestMeter(t *testing.T, mp MeterProvider, cfg Config) {
 		a, _ = m3.GetValue(cfg.TestMeter1, d1, d2, checkDims1)
 		assert.Equal(t, 0.0, a-v3)
 	})
+	t.Run("GetValues", func(t *testing.T) {
+		m1 := mp.NewMeter(cfg.User1)
+		m1.Meter(cfg.TestMeter1, 1, nil)
+		m1.Meter(cfg.TestMeter2, 2, nil)
+		mp.Flush()
+
+		v1, _ := mp.GetValue(cfg.User1, cfg.TestMeter1, d1, d2, nil)
+		v2, _ := mp.GetValue(cfg.User1, cfg.TestMeter2, d1, d2, nil)
+		vals := meters.GetValues(mp, cfg.User1, []string{cfg.TestMeter1, cfg.TestMeter2}, d1, d2, nil)
+		assert.Equal(t, map[string]float64{cfg.TestMeter1: v1, cfg.TestMeter2: v2}, vals)
+	})
 }
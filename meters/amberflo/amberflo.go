@@ -1,6 +1,7 @@
 package amberflo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,14 +16,22 @@ import (
 
 func init() {
 	var _ meters.MeterProvider = &AmberfloMeterProvider{}
+	var _ meters.ContextFlusher = &AmberfloMeterProvider{}
 }
 
 type AmberfloMeterProvider struct {
+	// QueueSize is the number of events buffered ahead of the Amberflo client; zero uses DefaultQueueSize.
+	// Must be set before the first event is sent.
+	QueueSize int
+	// DropOnFull drops events when the queue is full instead of blocking the caller.
+	// Dropped events are counted in Stats.
+	DropOnFull  bool
 	apikey      string
 	interval    time.Duration
 	client      *metering.Metering
 	usageClient *metering.UsageClient
 	cfgs        map[string]amberFloConfig
+	queue       eventQueue
 }
 
 func NewAmberfloMeterProvider(apikey string, interval time.Duration, batchSize int) *AmberfloMeterProvider {
@@ -43,14 +52,17 @@ func NewAmberfloMeterProvider(apikey string, interval time.Duration, batchSize i
 		client:      meteringClient,
 		usageClient: usageClient,
 		cfgs:        map[string]amberFloConfig{},
+		queue:       eventQueue{send: meteringClient.Meter},
 	}
 }
 
 type amberFloConfig struct {
-	Name          string            `json:"name,omitempty"`
-	DefaultUser   string            `json:"default_user,omitempty"`
-	ExternalIDKey string            `json:"external_id_key,omitempty"`
-	Dimensions    meters.Dimensions `json:"dimensions,omitempty"`
+	Name          string `json:"name,omitempty"`
+	DefaultUser   string `json:"default_user,omitempty"`
+	ExternalIDKey string `json:"external_id_key,omitempty"`
+	// ExternalIDKeys are additional keys tried in order after ExternalIDKey
+	ExternalIDKeys []string          `json:"external_id_keys,omitempty"`
+	Dimensions     meters.Dimensions `json:"dimensions,omitempty"`
 }
 
 func (m *AmberfloMeterProvider) LoadConfig(path string) error {
@@ -74,15 +86,37 @@ func (m *AmberfloMeterProvider) NewMeter(user meters.MeterUser) meters.ApiMeter
 }
 
 func (m *AmberfloMeterProvider) Close() error {
+	m.queue.close()
 	return m.client.Shutdown()
 }
 
 func (m *AmberfloMeterProvider) Flush() error {
+	return m.FlushContext(context.Background())
+}
+
+func (m *AmberfloMeterProvider) FlushContext(ctx context.Context) error {
+	// Wait for queued events to reach the client, then for the client's send interval
 	// metering.Flush() // in API docs but not in library
-	time.Sleep(m.interval)
-	return nil
+	if err := m.queue.wait(ctx); err != nil {
+		return err
+	}
+	select {
+	case <-time.After(m.interval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// Stats returns counters for the send queue.
+func (m *AmberfloMeterProvider) Stats() QueueStats {
+	return m.queue.stats()
+}
+
+// GetValue returns the usage between the start and end times.
+// Amberflo groups usage into buckets of at least an hour, so start times that are not on an hour boundary
+// are effectively rounded down to the hour: a rolling:1h window starting at 10:37 includes usage from 10:00.
+// Rolling limits enforced with this provider are therefore approximate, and may count up to an hour of earlier usage.
 func (m *AmberfloMeterProvider) GetValue(user meters.MeterUser, meterName string, startTime time.Time, endTime time.Time, checkDims meters.Dimensions) (float64, bool) {
 	cfg, ok := m.getcfg(meterName)
 	if !ok {
@@ -95,6 +129,15 @@ func (m *AmberfloMeterProvider) GetValue(user meters.MeterUser, meterName string
 	if cfg.Name == "" {
 		return 0, false
 	}
+	if !endTime.After(startTime) {
+		log.Error().Str("user", user.ID()).Msg("could not get value; end time not after start time")
+		return 0, false
+	}
+	filter, ok := usageFilter(customerId, checkDims)
+	if !ok {
+		// Conflicting values for the same dimension key can never match an event
+		return 0, true
+	}
 	timeRange := &metering.TimeRange{
 		StartTimeInSeconds: startTime.In(time.UTC).Unix(),
 		EndTimeInSeconds:   endTime.In(time.UTC).Unix(),
@@ -102,23 +145,7 @@ func (m *AmberfloMeterProvider) GetValue(user meters.MeterUser, meterName string
 	if timeRange.EndTimeInSeconds > time.Now().In(time.UTC).Unix() {
 		timeRange.EndTimeInSeconds = 0
 	}
-
-	filter := make(map[string][]string)
-	filter["customerId"] = []string{customerId}
-	for _, dim := range checkDims {
-		filter[dim.Key] = []string{dim.Value}
-	}
-
-	timeGroupingInterval := metering.Hour
-	switch timeSpan := endTime.Unix() - startTime.Unix(); {
-	case timeSpan > 24*60*60:
-		timeGroupingInterval = metering.Month
-	case timeSpan > 60*60:
-		timeGroupingInterval = metering.Day
-	default:
-		timeGroupingInterval = metering.Hour
-	}
-
+	timeGroupingInterval := usageGroupingInterval(startTime, endTime)
 	usageResult, err := m.usageClient.GetUsage(&metering.UsagePayload{
 		MeterApiName:         cfg.Name,
 		Aggregation:          metering.Sum,
@@ -143,6 +170,39 @@ func (m *AmberfloMeterProvider) GetValue(user meters.MeterUser, meterName string
 	return total, true
 }
 
+// usageGroupingInterval selects the coarsest grouping interval that is aligned with the start time.
+// Usage is grouped into buckets starting on interval boundaries, so a window that does not begin on a
+// day or month boundary uses hourly buckets. Hour is the finest interval: a window that does not begin
+// on an hour boundary (e.g. a rolling window) still includes usage from the start of that hour.
+func usageGroupingInterval(startTime time.Time, endTime time.Time) metering.AggregationInterval {
+	st := startTime.In(time.UTC)
+	timeSpan := endTime.Sub(startTime)
+	dayAligned := st.Equal(time.Date(st.Year(), st.Month(), st.Day(), 0, 0, 0, 0, time.UTC))
+	monthAligned := dayAligned && st.Day() == 1
+	switch {
+	case timeSpan > 24*time.Hour && monthAligned:
+		return metering.Month
+	case timeSpan > time.Hour && dayAligned:
+		return metering.Day
+	}
+	return metering.Hour
+}
+
+// usageFilter builds a usage query filter for a customer and dimensions.
+// All dimensions must match, following meters.DimsContainedIn; returns false if
+// the dimensions contain conflicting values for the same key.
+func usageFilter(customerId string, checkDims meters.Dimensions) (map[string][]string, bool) {
+	filter := make(map[string][]string)
+	filter["customerId"] = []string{customerId}
+	for _, dim := range checkDims {
+		if v, ok := filter[dim.Key]; ok && v[0] != dim.Value {
+			return nil, false
+		}
+		filter[dim.Key] = []string{dim.Value}
+	}
+	return filter, true
+}
+
 func (m *AmberfloMeterProvider) sendMeter(user meters.MeterUser, meterName string, value float64, extraDimensions meters.Dimensions) error {
 	cfg, ok := m.getcfg(meterName)
 	if !ok {
@@ -162,7 +222,7 @@ func (m *AmberfloMeterProvider) sendMeter(user meters.MeterUser, meterName strin
 	for _, v := range extraDimensions {
 		amberFloDims[v.Key] = v.Value
 	}
-	return m.client.Meter(&metering.MeterMessage{
+	return m.queue.add(m.QueueSize, m.DropOnFull, &metering.MeterMessage{
 		MeterApiName:      cfg.Name,
 		UniqueId:          uniqueId,
 		MeterTimeInMillis: utcMillis,
@@ -175,20 +235,37 @@ func (m *AmberfloMeterProvider) sendMeter(user meters.MeterUser, meterName strin
 func (m *AmberfloMeterProvider) getCustomerID(cfg amberFloConfig, user meters.MeterUser) (string, bool) {
 	customerId := cfg.DefaultUser
 	if user != nil {
-		eidKey := cfg.ExternalIDKey
-		if eidKey == "" {
-			eidKey = "amberflo"
-		}
-		if a, ok := user.GetExternalData(eidKey); ok {
-			customerId = a
+		for _, eidKey := range cfg.externalIDKeys() {
+			if a, ok := user.GetExternalData(eidKey); ok && a != "" {
+				log.Trace().Str("user", user.ID()).Str("external_id_key", eidKey).Msg("found amberflo customer id")
+				customerId = a
+				break
+			}
 		}
 	}
 	if customerId == "" {
-		log.Error().Str("user", user.ID()).Str("external_id_key", cfg.ExternalIDKey).Msg("could not get value; no amberflo customer id")
+		userId := ""
+		if user != nil {
+			userId = user.ID()
+		}
+		log.Error().Str("user", userId).Strs("external_id_keys", cfg.externalIDKeys()).Msg("could not get value; no amberflo customer id")
 	}
 	return customerId, customerId != ""
 }
 
+// externalIDKeys returns the candidate external data keys in lookup order.
+func (cfg amberFloConfig) externalIDKeys() []string {
+	var keys []string
+	if cfg.ExternalIDKey != "" {
+		keys = append(keys, cfg.ExternalIDKey)
+	}
+	keys = append(keys, cfg.ExternalIDKeys...)
+	if len(keys) == 0 {
+		keys = append(keys, "amberflo")
+	}
+	return keys
+}
+
 func (m *AmberfloMeterProvider) getcfg(meterName string) (amberFloConfig, bool) {
 	cfg, ok := m.cfgs[meterName]
 	if !ok {
@@ -6,8 +6,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/amberflo/metering-go/v2"
 	"github.com/interline-io/transitland-dbutil/testutil"
 	"github.com/interline-io/transitland-mw/internal/metertest"
+	"github.com/interline-io/transitland-mw/meters"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAmberfloMeter(t *testing.T) {
@@ -39,3 +42,67 @@ func TestAmberfloMeter(t *testing.T) {
 	mp.cfgs[testConfig.TestMeter2] = amberFloConfig{Name: testConfig.TestMeter2, ExternalIDKey: eidKey}
 	metertest.TestMeter(t, mp, testConfig)
 }
+
+func TestUsageGroupingInterval(t *testing.T) {
+	monthStart := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	dayStart := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	hourStart := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	rollingStart := time.Date(2024, 3, 5, 10, 37, 0, 0, time.UTC)
+	tcs := []struct {
+		name   string
+		start  time.Time
+		end    time.Time
+		expect metering.AggregationInterval
+	}{
+		{"hourly", hourStart, hourStart.Add(time.Hour), metering.Hour},
+		{"daily", dayStart, dayStart.AddDate(0, 0, 1), metering.Day},
+		{"monthly", monthStart, monthStart.AddDate(0, 1, 0), metering.Month},
+		{"yearly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), metering.Month},
+		// Rolling windows are approximate: the finest interval is an hour, so usage from 10:00 is included
+		{"rolling 1h", rollingStart, rollingStart.Add(time.Hour), metering.Hour},
+		{"rolling 24h", rollingStart, rollingStart.Add(24 * time.Hour), metering.Hour},
+		{"rolling 30d from day boundary", dayStart, dayStart.AddDate(0, 0, 30), metering.Day},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, usageGroupingInterval(tc.start, tc.end))
+		})
+	}
+}
+
+func TestUsageFilter(t *testing.T) {
+	filter, ok := usageFilter("test", meters.Dimensions{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}})
+	assert.True(t, ok)
+	assert.Equal(t, map[string][]string{"customerId": {"test"}, "a": {"1"}, "b": {"2"}}, filter)
+
+	_, ok = usageFilter("test", meters.Dimensions{{Key: "a", Value: "1"}, {Key: "a", Value: "1"}})
+	assert.True(t, ok)
+
+	_, ok = usageFilter("test", meters.Dimensions{{Key: "a", Value: "1"}, {Key: "a", Value: "2"}})
+	assert.False(t, ok)
+}
+
+func TestAmberfloMeter_GetCustomerID(t *testing.T) {
+	mp := &AmberfloMeterProvider{}
+	tcs := []struct {
+		name   string
+		cfg    amberFloConfig
+		data   map[string]string
+		expect string
+	}{
+		{"default key", amberFloConfig{}, map[string]string{"amberflo": "a"}, "a"},
+		{"configured key", amberFloConfig{ExternalIDKey: "test"}, map[string]string{"amberflo": "a", "test": "b"}, "b"},
+		{"fallback key", amberFloConfig{ExternalIDKey: "test", ExternalIDKeys: []string{"legacy", "other"}}, map[string]string{"other": "c"}, "c"},
+		{"first matching key", amberFloConfig{ExternalIDKeys: []string{"legacy", "other"}}, map[string]string{"legacy": "d", "other": "c"}, "d"},
+		{"empty value skipped", amberFloConfig{ExternalIDKeys: []string{"legacy", "other"}}, map[string]string{"legacy": "", "other": "c"}, "c"},
+		{"default user", amberFloConfig{ExternalIDKeys: []string{"legacy"}, DefaultUser: "default"}, nil, "default"},
+		{"no match", amberFloConfig{ExternalIDKeys: []string{"legacy"}}, map[string]string{"amberflo": "a"}, ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			customerId, ok := mp.getCustomerID(tc.cfg, metertest.NewTestUser("test", tc.data))
+			assert.Equal(t, tc.expect, customerId)
+			assert.Equal(t, tc.expect != "", ok)
+		})
+	}
+}
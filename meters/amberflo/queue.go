@@ -0,0 +1,142 @@
+package amberflo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amberflo/metering-go/v2"
+	"github.com/interline-io/log"
+)
+
+// DefaultQueueSize is the number of events buffered ahead of the Amberflo client.
+const DefaultQueueSize = 10000
+
+var errQueueClosed = errors.New("amberflo: provider closed")
+
+// QueueStats reports the state of the send queue.
+type QueueStats struct {
+	Depth   int           // Events waiting to be handed to the client
+	Sent    int64         // Events handed to the client
+	Errors  int64         // Events rejected by the client
+	Dropped int64         // Events dropped because the queue was full
+	Blocked int64         // Events that waited for space in the queue
+	MaxWait time.Duration // Longest time the client took to accept an event
+}
+
+// eventQueue decouples callers from the Amberflo client, which blocks when its own buffer is full.
+type eventQueue struct {
+	send      func(*metering.MeterMessage) error
+	ch        chan *metering.MeterMessage
+	startOnce sync.Once
+	lock      sync.RWMutex
+	closed    bool
+	pending   atomic.Int64
+	done      chan struct{}
+	sent      atomic.Int64
+	errors    atomic.Int64
+	dropped   atomic.Int64
+	blocked   atomic.Int64
+	maxWait   atomic.Int64
+}
+
+// start creates the channel and send goroutine, unless the queue is already closed.
+func (q *eventQueue) start(size int) {
+	q.startOnce.Do(func() {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		if q.closed {
+			return
+		}
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+		q.ch = make(chan *metering.MeterMessage, size)
+		q.done = make(chan struct{})
+		go q.run()
+	})
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+	for msg := range q.ch {
+		t := time.Now()
+		if err := q.send(msg); err != nil {
+			q.errors.Add(1)
+			log.Error().Err(err).Str("meter", msg.MeterApiName).Msg("amberflo: could not send event")
+		} else {
+			q.sent.Add(1)
+		}
+		if d := int64(time.Since(t)); d > q.maxWait.Load() {
+			q.maxWait.Store(d)
+		}
+		q.pending.Add(-1)
+	}
+}
+
+func (q *eventQueue) add(size int, dropOnFull bool, msg *metering.MeterMessage) error {
+	q.start(size)
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	q.pending.Add(1)
+	select {
+	case q.ch <- msg:
+		return nil
+	default:
+	}
+	if dropOnFull {
+		q.pending.Add(-1)
+		q.dropped.Add(1)
+		log.Error().Str("meter", msg.MeterApiName).Str("customer_id", msg.CustomerId).Float64("value", msg.MeterValue).Msg("amberflo: queue full, dropping event")
+		return nil
+	}
+	q.blocked.Add(1)
+	q.ch <- msg
+	return nil
+}
+
+// wait blocks until all queued events have been handed to the client, or the context is done.
+func (q *eventQueue) wait(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for q.pending.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (q *eventQueue) close() {
+	q.lock.Lock()
+	if q.closed || q.ch == nil {
+		q.closed = true
+		q.lock.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.ch)
+	q.lock.Unlock()
+	<-q.done
+}
+
+func (q *eventQueue) stats() QueueStats {
+	q.lock.RLock()
+	depth := len(q.ch)
+	q.lock.RUnlock()
+	return QueueStats{
+		Depth:   depth,
+		Sent:    q.sent.Load(),
+		Errors:  q.errors.Load(),
+		Dropped: q.dropped.Load(),
+		Blocked: q.blocked.Load(),
+		MaxWait: time.Duration(q.maxWait.Load()),
+	}
+}
@@ -0,0 +1,120 @@
+package amberflo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amberflo/metering-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventQueue(t *testing.T) {
+	t.Run("send", func(t *testing.T) {
+		var lock sync.Mutex
+		var got []string
+		q := eventQueue{send: func(msg *metering.MeterMessage) error {
+			lock.Lock()
+			defer lock.Unlock()
+			got = append(got, msg.UniqueId)
+			if msg.UniqueId == "err" {
+				return errors.New("fail")
+			}
+			return nil
+		}}
+		for _, id := range []string{"a", "b", "err"} {
+			assert.NoError(t, q.add(10, false, &metering.MeterMessage{UniqueId: id}))
+		}
+		q.wait(context.Background())
+		lock.Lock()
+		assert.Equal(t, []string{"a", "b", "err"}, got)
+		lock.Unlock()
+		stats := q.stats()
+		assert.Equal(t, 0, stats.Depth)
+		assert.Equal(t, int64(2), stats.Sent)
+		assert.Equal(t, int64(1), stats.Errors)
+		q.close()
+		assert.ErrorIs(t, q.add(10, false, &metering.MeterMessage{}), errQueueClosed)
+	})
+	t.Run("drop on full", func(t *testing.T) {
+		release := make(chan struct{})
+		q := eventQueue{send: func(msg *metering.MeterMessage) error {
+			<-release
+			return nil
+		}}
+		// One event is held by the sender, one fills the queue, the rest are dropped
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, q.add(1, true, &metering.MeterMessage{}))
+			time.Sleep(10 * time.Millisecond)
+		}
+		stats := q.stats()
+		assert.Equal(t, 1, stats.Depth)
+		assert.Equal(t, int64(3), stats.Dropped)
+		close(release)
+		q.wait(context.Background())
+		assert.Equal(t, int64(2), q.stats().Sent)
+		q.close()
+	})
+	t.Run("block on full", func(t *testing.T) {
+		release := make(chan struct{})
+		q := eventQueue{send: func(msg *metering.MeterMessage) error {
+			<-release
+			return nil
+		}}
+		assert.NoError(t, q.add(1, false, &metering.MeterMessage{}))
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, q.add(1, false, &metering.MeterMessage{}))
+		added := make(chan struct{})
+		go func() {
+			q.add(1, false, &metering.MeterMessage{})
+			close(added)
+		}()
+		select {
+		case <-added:
+			t.Fatal("expected add to block")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+		<-added
+		q.wait(context.Background())
+		stats := q.stats()
+		assert.Equal(t, int64(3), stats.Sent)
+		assert.Equal(t, int64(1), stats.Blocked)
+		assert.Equal(t, int64(0), stats.Dropped)
+		q.close()
+	})
+	t.Run("wait deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		q := eventQueue{send: func(msg *metering.MeterMessage) error {
+			<-release
+			return nil
+		}}
+		assert.NoError(t, q.add(1, false, &metering.MeterMessage{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, q.wait(ctx), context.DeadlineExceeded)
+		close(release)
+		q.close()
+	})
+	t.Run("stats during first add", func(t *testing.T) {
+		q := eventQueue{send: func(msg *metering.MeterMessage) error {
+			return nil
+		}}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.add(10, false, &metering.MeterMessage{})
+		}()
+		q.stats()
+		wg.Wait()
+		q.close()
+	})
+	t.Run("close without events", func(t *testing.T) {
+		q := eventQueue{}
+		q.close()
+		assert.ErrorIs(t, q.add(1, false, &metering.MeterMessage{}), errQueueClosed)
+	})
+}
@@ -16,6 +16,8 @@ import (
 
 func init() {
 	var _ meters.MeterProvider = &CacheMeterProvider{}
+	var _ meters.ContextFlusher = &CacheMeterProvider{}
+	var _ meters.ContextCloser = &CacheMeterProvider{}
 }
 
 // CacheMeterKey should map to GetValue arguments
@@ -49,9 +51,59 @@ type userPasser struct {
 	users map[string]meters.MeterUser
 }
 
+// cacheIndexKey groups cached values by user and meter
+type cacheIndexKey struct {
+	User      string
+	MeterName string
+}
+
+// cacheIndex tracks cached keys and their decoded dimensions by user and meter
+type cacheIndex struct {
+	lock sync.Mutex
+	keys map[cacheIndexKey]map[CacheMeterKey]meters.Dimensions
+}
+
+func (ci *cacheIndex) add(key CacheMeterKey, dims meters.Dimensions) {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	ik := cacheIndexKey{User: key.User, MeterName: key.MeterName}
+	if ci.keys[ik] == nil {
+		ci.keys[ik] = map[CacheMeterKey]meters.Dimensions{}
+	}
+	ci.keys[ik][key] = dims
+}
+
+func (ci *cacheIndex) remove(key CacheMeterKey) {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	ik := cacheIndexKey{User: key.User, MeterName: key.MeterName}
+	delete(ci.keys[ik], key)
+	if len(ci.keys[ik]) == 0 {
+		delete(ci.keys, ik)
+	}
+}
+
+// active returns the keys for a user and meter whose period includes now and whose dimensions match the event.
+func (ci *cacheIndex) active(user string, meterName string, now int64, eventDims meters.Dimensions) []CacheMeterKey {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	var ret []CacheMeterKey
+	for key, keyDims := range ci.keys[cacheIndexKey{User: user, MeterName: meterName}] {
+		if now < key.Start || now >= key.End {
+			continue
+		}
+		if !meters.DimsContainedIn(keyDims, eventDims) {
+			continue
+		}
+		ret = append(ret, key)
+	}
+	return ret
+}
+
 // Wraps a meter with caching
 type CacheMeterProvider struct {
 	users *userPasser
+	index *cacheIndex
 	cache *rcache.Cache[CacheMeterKey, CacheMeterData]
 	meters.MeterProvider
 }
@@ -75,12 +127,16 @@ func NewCacheMeterProvider(provider meters.MeterProvider, topic string, redisCli
 		}
 
 		// Get value
+		var dims meters.Dimensions
+		if err := json.Unmarshal([]byte(key.Dims), &dims); err != nil {
+			return CacheMeterData{Value: 0}, err
+		}
 		val, ok := provider.GetValue(
 			user,
 			key.MeterName,
 			time.Unix(key.Start, 0),
 			time.Unix(key.End, 0),
-			nil,
+			dims,
 		)
 		log.Info().Str("key", key.User).Float64("value", val).Bool("ok", ok).Msg("rechecking meter result")
 
@@ -88,6 +144,9 @@ func NewCacheMeterProvider(provider meters.MeterProvider, topic string, redisCli
 	}
 
 	// Create cache
+	index := &cacheIndex{
+		keys: map[cacheIndexKey]map[CacheMeterKey]meters.Dimensions{},
+	}
 	cache := rcache.NewCache[CacheMeterKey, CacheMeterData](
 		refreshFn,
 		topic,
@@ -95,14 +154,44 @@ func NewCacheMeterProvider(provider meters.MeterProvider, topic string, redisCli
 	)
 	cache.Expires = expires
 	cache.Recheck = recheck
+	// Values for periods that have ended, including past rolling windows, are no longer rechecked
+	cache.Evict = func(key CacheMeterKey) bool {
+		if time.Now().Unix() < key.End {
+			return false
+		}
+		index.remove(key)
+		return true
+	}
 	cache.Start(refresh)
 	return &CacheMeterProvider{
 		MeterProvider: provider,
 		users:         up,
+		index:         index,
 		cache:         cache,
 	}
 }
 
+// Close stops the cache refresh goroutine and closes the wrapped provider.
+func (c *CacheMeterProvider) Close() error {
+	if err := c.cache.Close(); err != nil {
+		return err
+	}
+	return c.MeterProvider.Close()
+}
+
+// FlushContext flushes the wrapped provider, bounded by the context.
+func (c *CacheMeterProvider) FlushContext(ctx context.Context) error {
+	return meters.FlushContext(ctx, c.MeterProvider)
+}
+
+// CloseContext stops the cache refresh goroutine and closes the wrapped provider, bounded by the context.
+func (c *CacheMeterProvider) CloseContext(ctx context.Context) error {
+	if err := c.cache.Close(); err != nil {
+		return err
+	}
+	return meters.CloseContext(ctx, c.MeterProvider)
+}
+
 func (c *CacheMeterProvider) NewMeter(u meters.MeterUser) meters.ApiMeter {
 	return &CacheMeter{
 		user:     u,
@@ -126,18 +215,67 @@ func (m *CacheMeterProvider) GetValue(user meters.MeterUser, meterName string, s
 		End:       endTime.Unix(),
 		Dims:      string(dbuf),
 	}
+	m.index.add(key, dims)
 	if a, ok := m.cache.Get(context.Background(), key); ok {
 		return a.Value, true
 	}
 	return 0, false
 }
 
+// incrementCached optimistically adds a metered value to the locally cached values
+// for the user and meter whose period includes the current time and whose dimensions match the event.
+// The increment is not written to redis; cached values are corrected when they are next rechecked.
+func (m *CacheMeterProvider) incrementCached(user meters.MeterUser, meterName string, value float64, eventDims meters.Dimensions) {
+	if user == nil {
+		return
+	}
+	now := time.Now().In(time.UTC).Unix()
+	for _, key := range m.index.active(user.ID(), meterName, now, eventDims) {
+		ok := m.cache.Update(key, func(a CacheMeterData) CacheMeterData {
+			a.Value += value
+			return a
+		})
+		if !ok {
+			// No longer in the local cache
+			m.index.remove(key)
+		}
+	}
+}
+
 type CacheMeter struct {
 	user     meters.MeterUser
+	addDims  []eventAddDim
 	provider *CacheMeterProvider
 	meters.ApiMeter
 }
 
+func (m *CacheMeter) Meter(meterName string, value float64, extraDimensions meters.Dimensions) error {
+	if err := m.ApiMeter.Meter(meterName, value, extraDimensions); err != nil {
+		return err
+	}
+	// Copy in matching dimensions set through AddDimension
+	var eventDims []meters.Dimension
+	for _, addDim := range m.addDims {
+		if addDim.MeterName == meterName {
+			eventDims = append(eventDims, meters.Dimension{Key: addDim.Key, Value: addDim.Value})
+		}
+	}
+	eventDims = append(eventDims, extraDimensions...)
+	m.provider.incrementCached(m.user, meterName, value, eventDims)
+	return nil
+}
+
+func (m *CacheMeter) AddDimension(meterName string, key string, value string) {
+	m.addDims = append(m.addDims, eventAddDim{MeterName: meterName, Key: key, Value: value})
+	m.ApiMeter.AddDimension(meterName, key, value)
+}
+
 func (m *CacheMeter) GetValue(meterName string, startTime time.Time, endTime time.Time, dims meters.Dimensions) (float64, bool) {
 	return m.provider.GetValue(m.user, meterName, startTime, endTime, dims)
 }
+
+type eventAddDim struct {
+	MeterName string
+	Key       string
+	Value     string
+}
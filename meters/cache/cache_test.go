@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -46,11 +47,62 @@ func TestCacheMeter(t *testing.T) {
 		cmpm.Meter(meterName, 1, nil)
 		time.Sleep(1 * time.Second)
 	}
-	assert.Equal(t, 8.0, lastValue)
+	// Cached value is incremented on each Meter call
+	assert.Equal(t, 9.0, lastValue)
 	finalVal, _ := mp.GetValue(user, meterName, t1, t2, nil)
 	assert.Equal(t, 10.0, finalVal)
 }
 
+func TestCacheMeter_Increment(t *testing.T) {
+	t1, t2, err := meters.PeriodSpan("hourly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := metertest.NewTestUser("test1", nil)
+	meterName := "ok"
+	dimsA := meters.Dimensions{{Key: "test", Value: "a"}}
+	dimsB := meters.Dimensions{{Key: "test", Value: "b"}}
+	mp := localmeter.NewLocalMeterProvider()
+	cmp := NewCacheMeterProvider(
+		mp,
+		"testcachemeter",
+		nil,
+		1*time.Hour,
+		1*time.Hour,
+		1*time.Hour,
+	)
+	defer cmp.Close()
+	cmpm := cmp.NewMeter(user)
+
+	// Populate cache
+	for _, dims := range []meters.Dimensions{nil, dimsA, dimsB} {
+		val, _ := cmpm.GetValue(meterName, t1, t2, dims)
+		assert.Equal(t, 0.0, val)
+	}
+
+	// Cached values are updated without waiting for recheck
+	cmpm.Meter(meterName, 1, dimsA)
+	cmpm.Meter(meterName, 2, dimsA)
+	val, _ := cmpm.GetValue(meterName, t1, t2, nil)
+	assert.Equal(t, 3.0, val)
+	val, _ = cmpm.GetValue(meterName, t1, t2, dimsA)
+	assert.Equal(t, 3.0, val)
+	val, _ = cmpm.GetValue(meterName, t1, t2, dimsB)
+	assert.Equal(t, 0.0, val)
+
+	// Other users are not updated
+	val, _ = cmp.GetValue(metertest.NewTestUser("test2", nil), meterName, t1, t2, nil)
+	assert.Equal(t, 0.0, val)
+}
+
+func TestCacheMeterProvider_Context(t *testing.T) {
+	mp := &metertest.ContextProvider{MeterProvider: localmeter.NewLocalMeterProvider()}
+	cmp := NewCacheMeterProvider(mp, "testcachemeter", nil, 1*time.Hour, 1*time.Hour, 1*time.Hour)
+	assert.NoError(t, meters.ShutdownContext(context.Background(), cmp))
+	assert.True(t, mp.FlushedContext)
+	assert.True(t, mp.ClosedContext)
+}
+
 func TestCacheMeter_Limits(t *testing.T) {
 	if a, ok := testutil.CheckTestRedisClient(); !ok {
 		t.Skip(a)
@@ -89,3 +141,60 @@ func TestCacheMeter_Limits(t *testing.T) {
 	assert.GreaterOrEqual(t, finalVal, 5.0, "expected >=5")
 	assert.Less(t, finalVal, 10.0, "expected <10")
 }
+
+func TestCacheMeter_Rolling(t *testing.T) {
+	meterName := "ok"
+	user := metertest.NewTestUser("test1", nil)
+	t.Run("stable key", func(t *testing.T) {
+		cmp := NewCacheMeterProvider(localmeter.NewLocalMeterProvider(), "testcachemeter", nil, 1*time.Hour, 1*time.Hour, 1*time.Hour)
+		defer cmp.Close()
+		cmpm := cmp.NewMeter(user)
+		t1, t2, err := meters.PeriodSpan("rolling:1h")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmpm.GetValue(meterName, t1, t2, nil)
+		cmpm.Meter(meterName, 1, nil)
+		u1, u2, _ := meters.PeriodSpan("rolling:1h")
+		if !u2.Equal(t2) {
+			t.Skip("crossed a rolling step boundary")
+		}
+		// Same cache key, incremented without a recheck
+		val, _ := cmpm.GetValue(meterName, u1, u2, nil)
+		assert.Equal(t, 1.0, val)
+		assert.Len(t, cmp.cache.LocalKeys(), 1)
+	})
+	t.Run("ended spans are removed", func(t *testing.T) {
+		cmp := NewCacheMeterProvider(localmeter.NewLocalMeterProvider(), "testcachemeter", nil, 1*time.Hour, 1*time.Hour, 10*time.Millisecond)
+		defer cmp.Close()
+		cmpm := cmp.NewMeter(user)
+		t1, t2, _ := meters.PeriodSpan("rolling:1h")
+		cmpm.GetValue(meterName, t1.Add(-time.Hour), t2.Add(-time.Hour), nil)
+		cmpm.GetValue(meterName, t1, t2, nil)
+		// Removed by the refresh loop, not by Meter
+		assert.Eventually(t, func() bool {
+			return len(cmp.cache.LocalKeys()) == 1
+		}, time.Second, 10*time.Millisecond)
+		keys := cmp.cache.LocalKeys()
+		if assert.Len(t, keys, 1) {
+			assert.Equal(t, t2.Unix(), keys[0].End)
+		}
+		assert.Len(t, cmp.index.active(user.ID(), meterName, t1.Unix(), nil), 1)
+	})
+	t.Run("limits", func(t *testing.T) {
+		cmp := NewCacheMeterProvider(localmeter.NewLocalMeterProvider(), "testcachemeter", nil, 1*time.Hour, 1*time.Hour, 1*time.Hour)
+		defer cmp.Close()
+		limitMp := limitmeter.NewLimitMeterProvider(cmp)
+		limitMp.Enabled = true
+		limitMp.DefaultLimits = []limitmeter.UserMeterLimit{{MeterName: meterName, Period: "rolling:1h", Limit: 3}}
+		m := limitMp.NewMeter(user)
+		var errs int
+		for i := 0; i < 5; i++ {
+			if err := m.Meter(meterName, 1, nil); err != nil {
+				assert.ErrorIs(t, err, meters.ErrRateLimited)
+				errs++
+			}
+		}
+		assert.Equal(t, 2, errs)
+	})
+}
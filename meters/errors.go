@@ -0,0 +1,57 @@
+package meters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is returned, wrapped in a RateLimitError, when an event would exceed a limit.
+var ErrRateLimited = errors.New("rate check: limited")
+
+// RateLimitError describes the limit that rejected an event.
+type RateLimitError struct {
+	MeterName string
+	Dims      Dimensions
+	Period    string
+	Limit     float64
+	Current   float64
+	ResetAt   time.Time // End of the limit period
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: meter '%s' period '%s' limit %f current %f", ErrRateLimited.Error(), e.MeterName, e.Period, e.Limit, e.Current)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// retryAfter returns the seconds until the limit period resets, for use as a Retry-After header.
+// Periods without a meaningful reset time, such as "total" or rolling windows, return false.
+func retryAfter(err error, now time.Time) (string, bool) {
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.Period == "total" || strings.HasPrefix(rlErr.Period, rollingPrefix) || !rlErr.ResetAt.After(now) {
+		return "", false
+	}
+	return strconv.Itoa(int(math.Ceil(rlErr.ResetAt.Sub(now).Seconds()))), true
+}
+
+func makeRateLimitJsonError(msg string, err error) string {
+	a := map[string]any{
+		"error": msg,
+	}
+	var rlErr *RateLimitError
+	if errors.As(err, &rlErr) {
+		a["meter"] = rlErr.MeterName
+		a["period"] = rlErr.Period
+		a["limit"] = rlErr.Limit
+		a["current"] = rlErr.Current
+	}
+	jj, _ := json.Marshal(&a)
+	return string(jj)
+}
@@ -0,0 +1,101 @@
+package meters
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseInfo describes a completed response.
+type ResponseInfo struct {
+	StatusCode   int
+	BytesWritten int64
+}
+
+// MeterValueFunc computes a meter value from a request and its response.
+type MeterValueFunc func(*http.Request, ResponseInfo) float64
+
+// WithMeterFunc meters each request with a value computed after the handler runs,
+// e.g. from the number of bytes written.
+func WithMeterFunc(apiMeter MeterProvider, meterName string, valueFunc MeterValueFunc, dims Dimensions) func(http.Handler) http.Handler {
+	return WithMeterConfig(apiMeter, MeterConfig{
+		MeterName: meterName,
+		Dims:      dims,
+		ValueFunc: valueFunc,
+	})
+}
+
+// meterResponseWriter records the status code and response size.
+type meterResponseWriter struct {
+	http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+	bytesWritten  int64
+}
+
+func newMeterResponseWriter(w http.ResponseWriter) *meterResponseWriter {
+	return &meterResponseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (mw *meterResponseWriter) WriteHeader(statusCode int) {
+	mw.ResponseWriter.WriteHeader(statusCode)
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+func (mw *meterResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	n, err := mw.ResponseWriter.Write(b)
+	mw.bytesWritten += int64(n)
+	return n, err
+}
+
+func (mw *meterResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+func (mw *meterResponseWriter) Flush() {
+	mw.headerWritten = true
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (mw *meterResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := mw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (mw *meterResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := mw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (mw *meterResponseWriter) responseInfo() ResponseInfo {
+	return ResponseInfo{
+		StatusCode:   mw.statusCode,
+		BytesWritten: mw.bytesWritten,
+	}
+}
+
+// countingReadCloser records the number of request body bytes read.
+type countingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytesRead += int64(n)
+	return n, err
+}
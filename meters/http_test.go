@@ -0,0 +1,153 @@
+package meters
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMeterFunc(t *testing.T) {
+	tcs := []struct {
+		name   string
+		code   int
+		body   string
+		expect ResponseInfo
+	}{
+		{"ok", 0, "hello", ResponseInfo{StatusCode: 200, BytesWritten: 5}},
+		{"status", 404, "not found", ResponseInfo{StatusCode: 404, BytesWritten: 9}},
+		{"empty", 204, "", ResponseInfo{StatusCode: 204, BytesWritten: 0}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := newTestMeterProvider()
+			var got ResponseInfo
+			valueFunc := func(r *http.Request, info ResponseInfo) float64 {
+				got = info
+				return float64(info.BytesWritten)
+			}
+			h := WithMeterFunc(mp, "test", valueFunc, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.NotNil(t, ForContext(r.Context()))
+				if tc.code > 0 {
+					w.WriteHeader(tc.code)
+				}
+				w.Write([]byte(tc.body))
+			}))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.expect, got)
+			assert.Equal(t, tc.body, rr.Body.String())
+			assert.Equal(t, []testMeterEvent{{name: "test", value: float64(len(tc.body))}}, mp.events)
+		})
+	}
+}
+
+func TestWithMeterConfig_Bytes(t *testing.T) {
+	tcs := []struct {
+		name          string
+		body          string
+		contentLength int64
+		readBody      bool
+		expectReq     float64
+	}{
+		{"content length", "hello", 5, false, 5},
+		{"unknown length", "hello", -1, true, 5},
+		{"unknown length unread", "hello", -1, false, 0},
+		{"empty", "", 0, true, 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := newTestMeterProvider()
+			h := WithMeterConfig(mp, MeterConfig{
+				MeterName:          "requests",
+				MeterValue:         1,
+				RequestBytesMeter:  "request_bytes",
+				ResponseBytesMeter: "response_bytes",
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.readBody {
+					io.ReadAll(r.Body)
+				}
+				w.Write([]byte("response"))
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			req.ContentLength = tc.contentLength
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, []testMeterEvent{
+				{name: "requests", value: 1},
+				{name: "request_bytes", value: tc.expectReq},
+				{name: "response_bytes", value: 8},
+			}, mp.events)
+		})
+	}
+	t.Run("rate limited", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		mp.limit = 1
+		h := WithMeterConfig(mp, MeterConfig{
+			MeterName:          "requests",
+			MeterValue:         2,
+			RequestBytesMeter:  "request_bytes",
+			ResponseBytesMeter: "response_bytes",
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Len(t, mp.events, 0)
+	})
+}
+
+func TestMeterResponseWriter_Passthrough(t *testing.T) {
+	rr := httptest.NewRecorder()
+	var w http.ResponseWriter = newMeterResponseWriter(rr)
+	f, ok := w.(http.Flusher)
+	if assert.True(t, ok) {
+		f.Flush()
+		assert.True(t, rr.Flushed)
+	}
+	h, ok := w.(http.Hijacker)
+	if assert.True(t, ok) {
+		_, _, err := h.Hijack()
+		assert.ErrorIs(t, err, http.ErrNotSupported)
+	}
+	p, ok := w.(http.Pusher)
+	if assert.True(t, ok) {
+		assert.ErrorIs(t, p.Push("/", nil), http.ErrNotSupported)
+	}
+}
+
+func TestWithMeterConfig_SuccessFunc(t *testing.T) {
+	tcs := []struct {
+		name        string
+		successFunc func(int) bool
+		valueFunc   MeterValueFunc
+		code        int
+		expect      []testMeterEvent
+	}{
+		{"default ok", DefaultSuccessFunc, nil, 200, []testMeterEvent{{name: "test", value: 1}}},
+		{"default not found", DefaultSuccessFunc, nil, 404, nil},
+		{"default error", DefaultSuccessFunc, nil, 500, nil},
+		{"not found is success", func(code int) bool { return code < 400 || code == 404 }, nil, 404, []testMeterEvent{{name: "test", value: 1}}},
+		{"with value func", DefaultSuccessFunc, func(r *http.Request, info ResponseInfo) float64 { return 3 }, 200, []testMeterEvent{{name: "test", value: 3}}},
+		{"with value func error", DefaultSuccessFunc, func(r *http.Request, info ResponseInfo) float64 { return 3 }, 500, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := newTestMeterProvider()
+			h := WithMeterConfig(mp, MeterConfig{
+				MeterName:   "test",
+				MeterValue:  1,
+				SuccessFunc: tc.successFunc,
+				ValueFunc:   tc.valueFunc,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.code)
+			}))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.code, rr.Code)
+			assert.Equal(t, tc.expect, mp.events)
+		})
+	}
+}
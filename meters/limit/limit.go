@@ -1,7 +1,7 @@
 package limit
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"time"
 
@@ -12,11 +12,19 @@ import (
 
 func init() {
 	var _ meters.MeterProvider = &LimitMeterProvider{}
+	var _ meters.LimitChecker = &LimitMeter{}
+	var _ meters.ContextFlusher = &LimitMeterProvider{}
+	var _ meters.ContextCloser = &LimitMeterProvider{}
 }
 
 type LimitMeterProvider struct {
-	Enabled       bool
-	DefaultLimits []UserMeterLimit
+	Enabled bool
+	// DryRun logs events that would exceed a limit but does not reject them.
+	DryRun bool
+	// UserLimitsOverride replaces default limits with user limits for the same meter, dimensions, period, and match mode.
+	// Default limits for other periods still apply. When false, both user and default limits apply.
+	UserLimitsOverride bool
+	DefaultLimits      []UserMeterLimit
 	meters.MeterProvider
 }
 
@@ -26,6 +34,16 @@ func NewLimitMeterProvider(provider meters.MeterProvider) *LimitMeterProvider {
 	}
 }
 
+// FlushContext flushes the wrapped provider, bounded by the context.
+func (c *LimitMeterProvider) FlushContext(ctx context.Context) error {
+	return meters.FlushContext(ctx, c.MeterProvider)
+}
+
+// CloseContext closes the wrapped provider, bounded by the context.
+func (c *LimitMeterProvider) CloseContext(ctx context.Context) error {
+	return meters.CloseContext(ctx, c.MeterProvider)
+}
+
 func (c *LimitMeterProvider) NewMeter(u meters.MeterUser) meters.ApiMeter {
 	userData, _ := u.GetExternalData("gatekeeper")
 	return &LimitMeter{
@@ -44,35 +62,85 @@ type LimitMeter struct {
 }
 
 func (c *LimitMeter) GetLimits(meterName string, checkDims meters.Dimensions) []UserMeterLimit {
-	// The limit matches the event dimensions if all of the LIMIT dimensions are contained in event
+	// See UserMeterLimit.MatchMode for how limits are matched to event dimensions
 	var lims []UserMeterLimit
-	for _, userLimit := range parseGkUserLimits(c.userData) {
-		if userLimit.MeterName == meterName && meters.DimsContainedIn(userLimit.Dims, checkDims) {
-			lims = append(lims, userLimit)
+	for _, lim := range c.Limits() {
+		if lim.Matches(meterName, checkDims) {
+			lims = append(lims, lim)
 		}
 	}
+	return lims
+}
+
+// Limits returns all user and default limits that apply to the user.
+func (c *LimitMeter) Limits() []UserMeterLimit {
+	userLimits := parseGkUserLimits(c.userData)
+	lims := append([]UserMeterLimit{}, userLimits...)
 	for _, defaultLimit := range c.provider.DefaultLimits {
-		if defaultLimit.MeterName == meterName && meters.DimsContainedIn(defaultLimit.Dims, checkDims) {
-			lims = append(lims, defaultLimit)
+		if c.provider.UserLimitsOverride && hasOverride(userLimits, defaultLimit) {
+			continue
 		}
+		lims = append(lims, defaultLimit)
 	}
 	return lims
 }
 
 func (c *LimitMeter) Meter(meterName string, value float64, extraDimensions meters.Dimensions) error {
+	if err := c.checkLimits(meterName, value, extraDimensions, false); err != nil {
+		return err
+	}
+	return c.ApiMeter.Meter(meterName, value, extraDimensions)
+}
+
+// MeterWithoutLimits records an event without checking limits.
+func (c *LimitMeter) MeterWithoutLimits(meterName string, value float64, extraDimensions meters.Dimensions) error {
+	return c.ApiMeter.Meter(meterName, value, extraDimensions)
+}
+
+// CheckLimits returns a *meters.RateLimitError if recording the value would exceed a limit.
+// A zero value checks whether a limit has already been reached.
+func (c *LimitMeter) CheckLimits(meterName string, value float64, extraDimensions meters.Dimensions) error {
+	return c.checkLimits(meterName, value, extraDimensions, value == 0)
+}
+
+// checkLimits rejects values that would exceed a limit, or if reached is set, values for limits already reached.
+func (c *LimitMeter) checkLimits(meterName string, value float64, extraDimensions meters.Dimensions, reached bool) error {
 	if c.provider.Enabled {
 		for _, lim := range c.GetLimits(meterName, extraDimensions) {
 			d1, d2 := lim.Span()
-			currentValue, _ := c.GetValue(meterName, d1, d2, lim.Dims)
-			if currentValue+value > lim.Limit {
+			currentValue, _ := c.GetValue(meterName, d1, d2, lim.valueDims())
+			exceeded := currentValue+value > lim.Limit || (reached && currentValue >= lim.Limit)
+			if exceeded && c.provider.DryRun {
+				log.Info().Str("meter", meterName).Str("user", c.userId).Float64("limit", lim.Limit).Float64("current", currentValue).Float64("add", value).Str("dims", fmt.Sprintf("%v", lim.Dims)).Str("period", lim.Period).Msg("rate check: dry run, would be limited")
+			} else if exceeded {
 				log.Info().Str("meter", meterName).Str("user", c.userId).Float64("limit", lim.Limit).Float64("current", currentValue).Float64("add", value).Str("dims", fmt.Sprintf("%v", lim.Dims)).Msg("rate limited")
-				return errors.New("rate check: limited")
+				return &meters.RateLimitError{
+					MeterName: meterName,
+					Dims:      lim.Dims,
+					Period:    lim.Period,
+					Limit:     lim.Limit,
+					Current:   currentValue,
+					ResetAt:   d2,
+				}
 			} else {
 				log.Info().Str("meter", meterName).Str("user", c.userId).Float64("limit", lim.Limit).Float64("current", currentValue).Float64("add", value).Str("dims", fmt.Sprintf("%v", lim.Dims)).Msg("rate check: ok")
 			}
 		}
 	}
-	return c.ApiMeter.Meter(meterName, value, extraDimensions)
+	return nil
+}
+
+// hasOverride checks if any user limit is for the same meter, dimensions, period, and match mode as a default limit.
+func hasOverride(userLimits []UserMeterLimit, defaultLimit UserMeterLimit) bool {
+	for _, userLimit := range userLimits {
+		if userLimit.MeterName == defaultLimit.MeterName &&
+			meters.DimsEqual(userLimit.Dims, defaultLimit.Dims) &&
+			userLimit.Period == defaultLimit.Period &&
+			userLimit.matchMode() == defaultLimit.matchMode() {
+			return true
+		}
+	}
+	return false
 }
 
 func parseGkUserLimits(v string) []UserMeterLimit {
@@ -83,6 +151,7 @@ func parseGkUserLimits(v string) []UserMeterLimit {
 				MeterName: plim.Get("amberflo_meter").String(),
 				Limit:     plim.Get("limit_value").Float(),
 				Period:    plim.Get("time_period").String(),
+				MatchMode: MatchMode(plim.Get("match_mode").String()),
 			}
 			if dim := plim.Get("amberflo_dimension").String(); dim != "" {
 				lim.Dims = append(lim.Dims, meters.Dimension{
@@ -96,12 +165,58 @@ func parseGkUserLimits(v string) []UserMeterLimit {
 	return lims
 }
 
+// MatchMode controls which events a limit applies to.
+type MatchMode string
+
+const (
+	// MatchSubset applies the limit when all limit dimensions are contained in the event dimensions.
+	// This is the default.
+	MatchSubset MatchMode = "subset"
+	// MatchExact applies the limit only when the event dimensions are exactly the limit dimensions.
+	// Providers can only filter usage by contained dimensions, so the current value still counts
+	// events with additional dimensions: those events are not limited, but they use up the limit.
+	MatchExact MatchMode = "exact"
+	// MatchAny applies the limit to all events for the meter, and counts all events regardless of dimensions.
+	MatchAny MatchMode = "any"
+)
+
 type UserMeterLimit struct {
 	User      string
 	MeterName string
 	Dims      meters.Dimensions
 	Period    string
 	Limit     float64
+	MatchMode MatchMode
+}
+
+// Matches checks if the limit applies to an event.
+func (lim *UserMeterLimit) Matches(meterName string, eventDims meters.Dimensions) bool {
+	if lim.MeterName != meterName {
+		return false
+	}
+	switch lim.MatchMode {
+	case MatchAny:
+		return true
+	case MatchExact:
+		return meters.DimsEqual(lim.Dims, eventDims)
+	}
+	return meters.DimsContainedIn(lim.Dims, eventDims)
+}
+
+// matchMode returns the match mode, with the default applied.
+func (lim *UserMeterLimit) matchMode() MatchMode {
+	if lim.MatchMode == "" {
+		return MatchSubset
+	}
+	return lim.MatchMode
+}
+
+// valueDims returns the dimensions used to read the current value for the limit.
+func (lim *UserMeterLimit) valueDims() meters.Dimensions {
+	if lim.MatchMode == MatchAny {
+		return nil
+	}
+	return lim.Dims
 }
 
 func (lim *UserMeterLimit) Span() (time.Time, time.Time) {
@@ -1,9 +1,13 @@
 package limit
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/interline-io/transitland-mw/auth/authn"
 	"github.com/interline-io/transitland-mw/internal/metertest"
 	"github.com/interline-io/transitland-mw/meters"
 	localmeter "github.com/interline-io/transitland-mw/meters/local"
@@ -72,6 +76,288 @@ func TestLimitMeter_Gatekeeper(t *testing.T) {
 	}
 }
 
+func TestLimitMeter_WithMeterConfig(t *testing.T) {
+	meterName := "testmeter"
+	lim := UserMeterLimit{MeterName: meterName, Period: "hourly", Limit: 1.0}
+	rlDims := meters.Dimensions{{Key: meters.RateLimitedDimension, Value: "true"}}
+	for _, recordRateLimited := range []bool{false, true} {
+		t.Run(fmt.Sprintf("RecordRateLimited=%t", recordRateLimited), func(t *testing.T) {
+			mp := localmeter.NewLocalMeterProvider()
+			defer mp.Close()
+			cmp := NewLimitMeterProvider(mp)
+			cmp.Enabled = true
+			cmp.DefaultLimits = []UserMeterLimit{lim}
+			h := meters.WithMeterConfig(cmp, meters.MeterConfig{
+				MeterName:         meterName,
+				MeterValue:        1.0,
+				RecordRateLimited: recordRateLimited,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			user := authn.NewCtxUser("testuser", "", "")
+			var codes []int
+			retryAfter := ""
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req = req.WithContext(authn.WithUser(req.Context(), user))
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				codes = append(codes, rr.Code)
+				retryAfter = rr.Header().Get("Retry-After")
+			}
+			assert.Equal(t, []int{200, 429, 429}, codes)
+			assert.NotEmpty(t, retryAfter)
+
+			// Rejected requests do not count toward the limit
+			d1, d2 := lim.Span()
+			total, _ := mp.GetValue(user, meterName, d1, d2, nil)
+			assert.Equal(t, 1.0, total)
+			limited, ok := mp.GetValue(user, meterName, d1, d2, rlDims)
+			assert.Equal(t, 0.0, limited)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestLimitMeter_WithMeterConfigAfterHandler(t *testing.T) {
+	meterName := "testmeter"
+	lim := UserMeterLimit{MeterName: meterName, Period: "hourly", Limit: 2.0}
+	tcs := []struct {
+		name   string
+		cfg    meters.MeterConfig
+		status int
+		codes  []int
+		total  float64
+	}{
+		{
+			"success func",
+			meters.MeterConfig{MeterName: meterName, MeterValue: 1, SuccessFunc: meters.DefaultSuccessFunc},
+			200,
+			[]int{200, 200, 429, 429},
+			2,
+		},
+		{
+			"success func not counted",
+			meters.MeterConfig{MeterName: meterName, MeterValue: 1, SuccessFunc: meters.DefaultSuccessFunc},
+			404,
+			[]int{404, 404, 404, 404},
+			0,
+		},
+		{
+			"value func",
+			meters.MeterConfig{MeterName: meterName, ValueFunc: func(r *http.Request, ri meters.ResponseInfo) float64 { return 1.5 }},
+			200,
+			// Checked with a zero value: admitted until the limit is reached, and recorded even if it is exceeded
+			[]int{200, 200, 429, 429},
+			3,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := localmeter.NewLocalMeterProvider()
+			defer mp.Close()
+			cmp := NewLimitMeterProvider(mp)
+			cmp.Enabled = true
+			cmp.DefaultLimits = []UserMeterLimit{lim}
+			h := meters.WithMeterConfig(cmp, tc.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			user := authn.NewCtxUser("testuser", "", "")
+			var codes []int
+			for i := 0; i < len(tc.codes); i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req = req.WithContext(authn.WithUser(req.Context(), user))
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				codes = append(codes, rr.Code)
+			}
+			assert.Equal(t, tc.codes, codes)
+			d1, d2 := lim.Span()
+			total, _ := mp.GetValue(user, meterName, d1, d2, nil)
+			assert.Equal(t, tc.total, total)
+		})
+	}
+}
+
+func TestLimitMeter_RetryAfter(t *testing.T) {
+	meterName := "testmeter"
+	tcs := []struct {
+		period string
+		expect bool
+	}{
+		{"hourly", true},
+		{"rolling:24h", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.period, func(t *testing.T) {
+			mp := localmeter.NewLocalMeterProvider()
+			defer mp.Close()
+			cmp := NewLimitMeterProvider(mp)
+			cmp.Enabled = true
+			cmp.DefaultLimits = []UserMeterLimit{{MeterName: meterName, Period: tc.period, Limit: 1.0}}
+			h := meters.WithMeter(cmp, meterName, 1.0, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			user := authn.NewCtxUser("testuser", "", "")
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req = req.WithContext(authn.WithUser(req.Context(), user))
+				rr = httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+			}
+			assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+			assert.Equal(t, tc.expect, rr.Header().Get("Retry-After") != "")
+		})
+	}
+}
+
+func TestLimitMeter_ZeroValue(t *testing.T) {
+	meterName := "testmeter"
+	user := metertest.NewTestUser("testuser", nil)
+	mp := localmeter.NewLocalMeterProvider()
+	defer mp.Close()
+	cmp := NewLimitMeterProvider(mp)
+	cmp.Enabled = true
+	cmp.DefaultLimits = []UserMeterLimit{{MeterName: meterName, Period: "hourly", Limit: 1.0}}
+	m := cmp.NewMeter(user).(*LimitMeter)
+	assert.NoError(t, m.MeterWithoutLimits(meterName, 2.0, nil))
+	assert.ErrorIs(t, m.Meter(meterName, 0, nil), meters.ErrRateLimited, "zero-value events are rejected once over the limit")
+}
+
+func TestLimitMeterProvider_Context(t *testing.T) {
+	mp := &metertest.ContextProvider{MeterProvider: localmeter.NewLocalMeterProvider()}
+	cmp := NewLimitMeterProvider(mp)
+	assert.NoError(t, meters.ShutdownContext(context.Background(), cmp))
+	assert.True(t, mp.FlushedContext)
+	assert.True(t, mp.ClosedContext)
+}
+
+func TestLimitMeter_DryRun(t *testing.T) {
+	meterName := "testmeter"
+	user := metertest.NewTestUser("testuser", nil)
+	lim := UserMeterLimit{MeterName: meterName, Period: "hourly", Limit: 1.0}
+	mp := localmeter.NewLocalMeterProvider()
+	defer mp.Close()
+	cmp := NewLimitMeterProvider(mp)
+	cmp.Enabled = true
+	cmp.DryRun = true
+	cmp.DefaultLimits = []UserMeterLimit{lim}
+	m := cmp.NewMeter(user)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, m.Meter(meterName, 1.0, nil))
+	}
+	d1, d2 := lim.Span()
+	total, _ := m.GetValue(meterName, d1, d2, nil)
+	assert.Equal(t, 3.0, total, "events past the limit are still recorded")
+}
+
+func TestUserMeterLimit_Matches(t *testing.T) {
+	meterName := "testmeter"
+	a := meters.Dimension{Key: "a", Value: "1"}
+	b := meters.Dimension{Key: "b", Value: "2"}
+	tcs := []struct {
+		name      string
+		mode      MatchMode
+		eventName string
+		eventDims meters.Dimensions
+		expect    bool
+	}{
+		{"default same", "", meterName, meters.Dimensions{a}, true},
+		{"default superset", "", meterName, meters.Dimensions{a, b}, true},
+		{"default other", "", meterName, meters.Dimensions{b}, false},
+		{"subset same", MatchSubset, meterName, meters.Dimensions{a}, true},
+		{"subset superset", MatchSubset, meterName, meters.Dimensions{a, b}, true},
+		{"subset none", MatchSubset, meterName, nil, false},
+		{"exact same", MatchExact, meterName, meters.Dimensions{a}, true},
+		{"exact superset", MatchExact, meterName, meters.Dimensions{a, b}, false},
+		{"exact none", MatchExact, meterName, nil, false},
+		{"any same", MatchAny, meterName, meters.Dimensions{a}, true},
+		{"any other", MatchAny, meterName, meters.Dimensions{b}, true},
+		{"any none", MatchAny, meterName, nil, true},
+		{"any other meter", MatchAny, "other", nil, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			lim := UserMeterLimit{MeterName: meterName, Dims: meters.Dimensions{a}, MatchMode: tc.mode}
+			assert.Equal(t, tc.expect, lim.Matches(tc.eventName, tc.eventDims))
+		})
+	}
+}
+
+func TestLimitMeter_MatchAny(t *testing.T) {
+	meterName := "testmeter"
+	user := metertest.NewTestUser("testuser", nil)
+	mp := localmeter.NewLocalMeterProvider()
+	defer mp.Close()
+	cmp := NewLimitMeterProvider(mp)
+	cmp.Enabled = true
+	cmp.DefaultLimits = []UserMeterLimit{{MeterName: meterName, Period: "hourly", Limit: 2.0, MatchMode: MatchAny}}
+	m := cmp.NewMeter(user)
+	// Events with different dimensions count toward the same limit
+	assert.NoError(t, m.Meter(meterName, 1.0, meters.Dimensions{{Key: "a", Value: "1"}}))
+	assert.NoError(t, m.Meter(meterName, 1.0, meters.Dimensions{{Key: "b", Value: "2"}}))
+	assert.ErrorIs(t, m.Meter(meterName, 1.0, nil), meters.ErrRateLimited)
+}
+
+func TestLimitMeter_MatchExact(t *testing.T) {
+	meterName := "testmeter"
+	user := metertest.NewTestUser("testuser", nil)
+	a := meters.Dimension{Key: "a", Value: "1"}
+	b := meters.Dimension{Key: "b", Value: "2"}
+	mp := localmeter.NewLocalMeterProvider()
+	defer mp.Close()
+	cmp := NewLimitMeterProvider(mp)
+	cmp.Enabled = true
+	cmp.DefaultLimits = []UserMeterLimit{{MeterName: meterName, Period: "hourly", Limit: 2.0, Dims: meters.Dimensions{a}, MatchMode: MatchExact}}
+	m := cmp.NewMeter(user)
+	// Events with extra dimensions are not limited...
+	assert.NoError(t, m.Meter(meterName, 2.0, meters.Dimensions{a, b}))
+	assert.NoError(t, m.Meter(meterName, 1.0, meters.Dimensions{a, b}))
+	// ...but are counted toward the limit for exactly matching events
+	assert.ErrorIs(t, m.Meter(meterName, 1.0, meters.Dimensions{a}), meters.ErrRateLimited)
+}
+
+func TestLimitMeter_UserLimitsOverride(t *testing.T) {
+	meterName := "testmeter"
+	gkData := `{"product_limits":{"tlv2_api":[{"amberflo_meter":"testmeter","limit_value":5,"time_period":"hourly"}]}}`
+	user := metertest.NewTestUser("testuser", map[string]string{"gatekeeper": gkData})
+	defaultLimits := []UserMeterLimit{
+		{MeterName: meterName, Period: "hourly", Limit: 2.0, MatchMode: MatchSubset},
+		{MeterName: meterName, Period: "hourly", Limit: 3.0, Dims: meters.Dimensions{{Key: "a", Value: "1"}}},
+		// Default limits for other periods or match modes are not overridden
+		{MeterName: meterName, Period: "daily", Limit: 4.0},
+		{MeterName: meterName, Period: "hourly", Limit: 6.0, MatchMode: MatchExact},
+	}
+	tcs := []struct {
+		name       string
+		override   bool
+		expect     []float64
+		expectDims []float64
+	}{
+		{"additive", false, []float64{5, 2, 4, 6}, []float64{5, 2, 3, 4}},
+		{"override", true, []float64{5, 4, 6}, []float64{5, 3, 4}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := localmeter.NewLocalMeterProvider()
+			defer mp.Close()
+			cmp := NewLimitMeterProvider(mp)
+			cmp.Enabled = true
+			cmp.UserLimitsOverride = tc.override
+			cmp.DefaultLimits = defaultLimits
+			m := cmp.NewMeter(user).(*LimitMeter)
+			var got []float64
+			for _, lim := range m.GetLimits(meterName, nil) {
+				got = append(got, lim.Limit)
+			}
+			assert.Equal(t, tc.expect, got)
+			// Default limits with other dimensions are not overridden
+			got = nil
+			for _, lim := range m.GetLimits(meterName, meters.Dimensions{{Key: "a", Value: "1"}}) {
+				got = append(got, lim.Limit)
+			}
+			assert.Equal(t, tc.expectDims, got)
+		})
+	}
+}
+
 func testLims(meterName string) []UserMeterLimit {
 	testKey := 1 // time.Now().In(time.UTC).Unix()
 	lims := []UserMeterLimit{
@@ -113,6 +399,13 @@ func testLims(meterName string) []UserMeterLimit {
 			Limit:     200.0,
 			Dims:      meters.Dimensions{{Key: "ok", Value: fmt.Sprintf("bar:%d", testKey)}},
 		},
+		// rolling tests
+		{
+			MeterName: meterName,
+			Period:    "rolling:1h",
+			Limit:     230.0,
+			Dims:      meters.Dimensions{{Key: "ok", Value: fmt.Sprintf("baz:%d", testKey)}},
+		},
 	}
 	return lims
 }
@@ -130,11 +423,18 @@ func testLimitMeter(t *testing.T, cmp *LimitMeterProvider, meterName string, use
 	cmp.MeterProvider.Flush()
 
 	// push past limit
-	if err := m.Meter(meterName, incr+lim.Limit, lim.Dims); err == nil {
-		t.Error("expected error, got none")
+	err := m.Meter(meterName, incr+lim.Limit, lim.Dims)
+	var rlErr *meters.RateLimitError
+	if assert.ErrorAs(t, err, &rlErr) {
+		assert.ErrorIs(t, err, meters.ErrRateLimited)
+		assert.Equal(t, meterName, rlErr.MeterName)
+		assert.Equal(t, lim.Period, rlErr.Period)
+		assert.Equal(t, lim.Limit, rlErr.Limit)
+		assert.Equal(t, base+incr, rlErr.Current)
 	}
 
-	// Check updated value
+	// Check updated value; rolling periods end at the current time
+	startTime, endTime = lim.Span()
 	total, _ := m.GetValue(meterName, startTime, endTime, lim.Dims)
 	assert.Equal(t, base+incr, total, "expected total")
 }
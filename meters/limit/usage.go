@@ -0,0 +1,82 @@
+package limit
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/interline-io/log"
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/interline-io/transitland-mw/meters"
+)
+
+type usageResponse struct {
+	User   string       `json:"user"`
+	Limits []usageLimit `json:"limits"`
+}
+
+type usageLimit struct {
+	Meter   string            `json:"meter"`
+	Dims    map[string]string `json:"dims,omitempty"`
+	Period  string            `json:"period"`
+	Start   time.Time         `json:"start"`
+	End     time.Time         `json:"end"`
+	Limit   float64           `json:"limit"`
+	Current float64           `json:"current"`
+}
+
+// UsageHandler returns the context user's configured limits and current usage for each limit period.
+// Limits with an invalid period are logged and omitted.
+func UsageHandler(limitProvider *LimitMeterProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := authn.ForContext(r.Context())
+		if user == nil {
+			http.Error(w, makeJsonError(http.StatusText(http.StatusUnauthorized)), http.StatusUnauthorized)
+			return
+		}
+		lm, ok := limitProvider.NewMeter(user).(*LimitMeter)
+		if !ok {
+			http.Error(w, makeJsonError(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			return
+		}
+		ret := usageResponse{User: user.ID(), Limits: []usageLimit{}}
+		for _, lim := range lm.Limits() {
+			d1, d2, err := meters.PeriodSpan(lim.Period)
+			if err != nil {
+				log.Error().Err(err).Str("meter", lim.MeterName).Str("period", lim.Period).Msg("usage: invalid limit period")
+				continue
+			}
+			current, _ := lm.GetValue(lim.MeterName, d1, d2, lim.valueDims())
+			ul := usageLimit{
+				Meter:   lim.MeterName,
+				Period:  lim.Period,
+				Start:   d1,
+				End:     d2,
+				Limit:   lim.Limit,
+				Current: current,
+			}
+			for _, dim := range lim.Dims {
+				if ul.Dims == nil {
+					ul.Dims = map[string]string{}
+				}
+				ul.Dims[dim.Key] = dim.Value
+			}
+			ret.Limits = append(ret.Limits, ul)
+		}
+		jj, err := json.Marshal(ret)
+		if err != nil {
+			http.Error(w, makeJsonError(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jj)
+	})
+}
+
+func makeJsonError(msg string) string {
+	a := map[string]string{
+		"error": msg,
+	}
+	jj, _ := json.Marshal(&a)
+	return string(jj)
+}
@@ -0,0 +1,67 @@
+package limit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/interline-io/transitland-mw/meters"
+	localmeter "github.com/interline-io/transitland-mw/meters/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageHandler(t *testing.T) {
+	meterName := "testmeter"
+	mp := localmeter.NewLocalMeterProvider()
+	defer mp.Close()
+	cmp := NewLimitMeterProvider(mp)
+	cmp.Enabled = true
+	cmp.DefaultLimits = []UserMeterLimit{
+		{MeterName: meterName, Period: "hourly", Limit: 10},
+		{MeterName: meterName, Period: "daily", Limit: 20, Dims: meters.Dimensions{{Key: "a", Value: "1"}}},
+		// Omitted
+		{MeterName: "othermeter", Period: "fortnightly", Limit: 30},
+	}
+	gkData := `{"product_limits":{"tlv2_api":[{"amberflo_meter":"testmeter","limit_value":100,"time_period":"monthly"}]}}`
+	user := authn.NewCtxUser("testuser", "", "").WithExternalData(map[string]string{"gatekeeper": gkData})
+	m := cmp.NewMeter(user)
+	m.Meter(meterName, 1, nil)
+	m.Meter(meterName, 2, meters.Dimensions{{Key: "a", Value: "1"}})
+
+	t.Run("user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(authn.WithUser(req.Context(), user))
+		rr := httptest.NewRecorder()
+		UsageHandler(cmp).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp usageResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "testuser", resp.User)
+		type check struct {
+			Period  string
+			Limit   float64
+			Current float64
+		}
+		var got []check
+		for _, ul := range resp.Limits {
+			got = append(got, check{ul.Period, ul.Limit, ul.Current})
+		}
+		assert.Equal(t, []check{
+			{"monthly", 100, 3},
+			{"hourly", 10, 3},
+			{"daily", 20, 2},
+		}, got)
+		if assert.Len(t, resp.Limits, 3) {
+			assert.Equal(t, map[string]string{"a": "1"}, resp.Limits[2].Dims)
+		}
+	})
+	t.Run("no user", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		UsageHandler(cmp).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
@@ -10,16 +10,32 @@ import (
 
 func init() {
 	var _ meters.MeterProvider = &LocalMeterProvider{}
+	var _ meters.BatchValueGetter = &LocalMeterProvider{}
 }
 
+// DefaultRetention keeps events long enough for periods up to monthly.
+const DefaultRetention = 35 * 24 * time.Hour
+
+// How often expired events are pruned
+const defaultPruneInterval = 1 * time.Hour
+
 type LocalMeterProvider struct {
-	values map[string]localMeterUserEvents
-	lock   sync.Mutex
+	// Retention is how long events are kept before being pruned; zero, the default, disables pruning.
+	// Values for periods longer than the retention, such as yearly or total, only include retained events;
+	// DefaultRetention is suitable when limits use periods up to monthly.
+	// Expired events are pruned while recording new events, at most once per hour.
+	// Set before first use.
+	Retention     time.Duration
+	values        map[string]localMeterUserEvents
+	lock          sync.Mutex
+	pruneInterval time.Duration
+	lastPruned    time.Time
 }
 
 func NewLocalMeterProvider() *LocalMeterProvider {
 	return &LocalMeterProvider{
-		values: map[string]localMeterUserEvents{},
+		values:        map[string]localMeterUserEvents{},
+		pruneInterval: defaultPruneInterval,
 	}
 }
 
@@ -31,6 +47,62 @@ func (m *LocalMeterProvider) Close() error {
 	return nil
 }
 
+// pruneExpired drops events older than the retention period, if not done within the prune interval.
+// The lock must be held.
+func (m *LocalMeterProvider) pruneExpired(now time.Time) {
+	if m.Retention <= 0 || now.Sub(m.lastPruned) < m.pruneInterval {
+		return
+	}
+	m.lastPruned = now
+	cutoff := now.Add(-m.Retention)
+	log.Trace().Time("before", cutoff).Msg("local meter: pruning expired events")
+	m.prune(cutoff)
+}
+
+// Reset clears all recorded events.
+// This is primarily intended for testing and embedded use.
+func (m *LocalMeterProvider) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values = map[string]localMeterUserEvents{}
+}
+
+// ResetUser clears all recorded events for a single user.
+// This is primarily intended for testing and embedded use.
+func (m *LocalMeterProvider) ResetUser(userId string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, a := range m.values {
+		delete(a, userId)
+	}
+}
+
+// Prune drops events recorded before the cutoff time.
+// This is primarily intended for testing and embedded use.
+func (m *LocalMeterProvider) Prune(before time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.prune(before)
+}
+
+func (m *LocalMeterProvider) prune(before time.Time) {
+	for _, a := range m.values {
+		for userName, userEvents := range a {
+			var keep []localMeterEvent
+			for _, userEvent := range userEvents {
+				if !userEvent.time.Before(before) {
+					keep = append(keep, userEvent)
+				}
+			}
+			if len(keep) == 0 {
+				delete(a, userName)
+			} else {
+				a[userName] = keep
+			}
+		}
+	}
+}
+
 func (m *LocalMeterProvider) NewMeter(user meters.MeterUser) meters.ApiMeter {
 	return &localUserMeter{
 		user: user,
@@ -55,6 +127,7 @@ func (m *LocalMeterProvider) sendMeter(u meters.MeterUser, meterName string, val
 		time:  time.Now().In(time.UTC),
 		dims:  dims,
 	}
+	m.pruneExpired(event.time)
 	a[userName] = append(a[userName], event)
 	log.Trace().
 		Str("user", userName).
@@ -67,6 +140,23 @@ func (m *LocalMeterProvider) sendMeter(u meters.MeterUser, meterName string, val
 func (m *LocalMeterProvider) GetValue(u meters.MeterUser, meterName string, startTime time.Time, endTime time.Time, checkDims meters.Dimensions) (float64, bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	return m.getValue(u, meterName, startTime, endTime, checkDims)
+}
+
+// GetValues reads several meters while holding the lock once.
+func (m *LocalMeterProvider) GetValues(u meters.MeterUser, meterNames []string, startTime time.Time, endTime time.Time, checkDims meters.Dimensions) map[string]float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := map[string]float64{}
+	for _, meterName := range meterNames {
+		if v, ok := m.getValue(u, meterName, startTime, endTime, checkDims); ok {
+			ret[meterName] = v
+		}
+	}
+	return ret
+}
+
+func (m *LocalMeterProvider) getValue(u meters.MeterUser, meterName string, startTime time.Time, endTime time.Time, checkDims meters.Dimensions) (float64, bool) {
 	a, ok := m.values[meterName]
 	if !ok {
 		return 0, false
@@ -2,8 +2,11 @@ package local
 
 import (
 	"testing"
+	"time"
 
 	"github.com/interline-io/transitland-mw/internal/metertest"
+	"github.com/interline-io/transitland-mw/meters"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLocalMeter(t *testing.T) {
@@ -17,3 +20,74 @@ func TestLocalMeter(t *testing.T) {
 	}
 	metertest.TestMeter(t, mp, testConfig)
 }
+
+func TestLocalMeter_Reset(t *testing.T) {
+	d1, d2, _ := meters.PeriodSpan("hourly")
+	meterName := "test1"
+	user1 := metertest.NewTestUser("test1", nil)
+	user2 := metertest.NewTestUser("test2", nil)
+	t.Run("Reset", func(t *testing.T) {
+		mp := NewLocalMeterProvider()
+		mp.NewMeter(user1).Meter(meterName, 1, nil)
+		mp.NewMeter(user2).Meter(meterName, 2, nil)
+		v, _ := mp.GetValue(user1, meterName, d1, d2, nil)
+		assert.Equal(t, 1.0, v)
+		mp.Reset()
+		v, _ = mp.GetValue(user1, meterName, d1, d2, nil)
+		assert.Equal(t, 0.0, v)
+		v, _ = mp.GetValue(user2, meterName, d1, d2, nil)
+		assert.Equal(t, 0.0, v)
+	})
+	t.Run("ResetUser", func(t *testing.T) {
+		mp := NewLocalMeterProvider()
+		mp.NewMeter(user1).Meter(meterName, 1, nil)
+		mp.NewMeter(user2).Meter(meterName, 2, nil)
+		mp.ResetUser(user1.ID())
+		v, _ := mp.GetValue(user1, meterName, d1, d2, nil)
+		assert.Equal(t, 0.0, v)
+		v, _ = mp.GetValue(user2, meterName, d1, d2, nil)
+		assert.Equal(t, 2.0, v)
+	})
+	t.Run("Prune", func(t *testing.T) {
+		mp := NewLocalMeterProvider()
+		mp.NewMeter(user1).Meter(meterName, 1, nil)
+		mp.Prune(time.Now().Add(-time.Minute))
+		v, _ := mp.GetValue(user1, meterName, d1, d2, nil)
+		assert.Equal(t, 1.0, v)
+		mp.Prune(time.Now().Add(time.Minute))
+		v, _ = mp.GetValue(user1, meterName, d1, d2, nil)
+		assert.Equal(t, 0.0, v)
+	})
+}
+
+func TestLocalMeter_Retention(t *testing.T) {
+	d1, d2, _ := meters.PeriodSpan("hourly")
+	meterName := "test1"
+	user1 := metertest.NewTestUser("test1", nil)
+	tcs := []struct {
+		name          string
+		retention     time.Duration
+		pruneInterval time.Duration
+		expect        float64
+	}{
+		{"within retention", DefaultRetention, 0, 3.0},
+		{"disabled", 0, 0, 3.0},
+		{"expired", time.Millisecond, 0, 2.0},
+		{"within prune interval", time.Millisecond, time.Hour, 3.0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := NewLocalMeterProvider()
+			assert.Equal(t, time.Duration(0), mp.Retention, "pruning is disabled by default")
+			mp.Retention = tc.retention
+			mp.pruneInterval = tc.pruneInterval
+			m := mp.NewMeter(user1)
+			m.Meter(meterName, 1, nil)
+			time.Sleep(10 * time.Millisecond)
+			// Expired events are pruned when the next event is recorded
+			m.Meter(meterName, 2, nil)
+			v, _ := mp.GetValue(user1, meterName, d1, d2, nil)
+			assert.Equal(t, tc.expect, v)
+		})
+	}
+}
@@ -2,10 +2,13 @@ package meters
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/interline-io/log"
 	"github.com/interline-io/transitland-mw/auth/authn"
 )
 
@@ -17,6 +20,9 @@ type ApiMeter interface {
 	GetValue(string, time.Time, time.Time, Dimensions) (float64, bool)
 }
 
+// MeterProvider creates meters and reads back metered values.
+// Providers may batch events: Flush sends pending events and Close flushes and releases resources.
+// Use Shutdown to flush and close a provider when the process exits.
 type MeterProvider interface {
 	GetValue(MeterUser, string, time.Time, time.Time, Dimensions) (float64, bool)
 	NewMeter(MeterUser) ApiMeter
@@ -24,27 +30,240 @@ type MeterProvider interface {
 	Flush() error
 }
 
+// LimitChecker is an optional interface for meters that enforce limits,
+// allowing limits to be checked before a request and the event to be recorded after it.
+type LimitChecker interface {
+	// CheckLimits returns an error, such as a *RateLimitError, if recording the value would exceed a limit.
+	// A zero value checks whether a limit has already been reached.
+	CheckLimits(string, float64, Dimensions) error
+	// MeterWithoutLimits records an event without checking limits.
+	MeterWithoutLimits(string, float64, Dimensions) error
+}
+
+// BatchValueGetter is an optional interface for providers that can read several meters at once.
+type BatchValueGetter interface {
+	GetValues(MeterUser, []string, time.Time, time.Time, Dimensions) map[string]float64
+}
+
+// GetValues reads the values of several meters for a user.
+// Meters without a value are omitted from the result.
+// Providers that implement BatchValueGetter are read in a single call.
+func GetValues(apiMeter MeterProvider, user MeterUser, meterNames []string, startTime time.Time, endTime time.Time, dims Dimensions) map[string]float64 {
+	if bg, ok := apiMeter.(BatchValueGetter); ok {
+		return bg.GetValues(user, meterNames, startTime, endTime, dims)
+	}
+	ret := map[string]float64{}
+	for _, meterName := range meterNames {
+		if v, ok := apiMeter.GetValue(user, meterName, startTime, endTime, dims); ok {
+			ret[meterName] = v
+		}
+	}
+	return ret
+}
+
 type MeterUser interface {
 	ID() string
 	GetExternalData(string) (string, bool)
 }
 
+// RateLimitedDimension tags events recorded for requests rejected by a limit.
+const RateLimitedDimension = "rate_limited"
+
+// MeterConfig configures the metering middleware.
+type MeterConfig struct {
+	MeterName  string
+	MeterValue float64
+	Dims       Dimensions
+	// RecordRateLimited records a zero-value event tagged with RateLimitedDimension
+	// when a request is rejected. Off by default to avoid inflating billing meters.
+	RecordRateLimited bool
+	// ValueFunc, if set, computes the meter value after the handler runs.
+	// Limits are checked before the handler using MeterValue as the expected value;
+	// leave MeterValue zero to reject requests only once a limit has been reached.
+	ValueFunc MeterValueFunc
+	// DimsFunc, if set, derives additional dimensions from the request, e.g. method or route.
+	// These are appended to Dims.
+	DimsFunc func(*http.Request) Dimensions
+	// FlushAfterRequest flushes the provider after each request completes.
+	// Intended for low volume deployments; some providers block during Flush.
+	FlushAfterRequest bool
+	// RequestBytesMeter and ResponseBytesMeter, if set, record the request and response body sizes
+	// as separate events with the same dimensions, after the handler runs.
+	RequestBytesMeter  string
+	ResponseBytesMeter string
+	// SuccessFunc, if set, decides from the response status code whether the request is recorded.
+	// Like ValueFunc, limits are checked before the handler and the event is recorded after it.
+	// See DefaultSuccessFunc.
+	SuccessFunc func(statusCode int) bool
+}
+
+// DefaultSuccessFunc counts responses with status codes below 400 as successful.
+func DefaultSuccessFunc(statusCode int) bool {
+	return statusCode < 400
+}
+
 func WithMeter(apiMeter MeterProvider, meterName string, meterValue float64, dims Dimensions) func(http.Handler) http.Handler {
+	return WithMeterConfig(apiMeter, MeterConfig{
+		MeterName:  meterName,
+		MeterValue: meterValue,
+		Dims:       dims,
+	})
+}
+
+// WithMeterConfig records a meter event for each request and responds with 429 when a limit is exceeded.
+// When ValueFunc or SuccessFunc is set, the event is recorded after the handler runs. Limits are then
+// enforced before the handler only if the provider's meters implement LimitChecker, as limit.LimitMeter does;
+// with other providers, setting either field disables limit enforcement.
+// Errors other than ErrRateLimited, such as a failing backend, are logged and the request is allowed.
+func WithMeterConfig(apiMeter MeterProvider, cfg MeterConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Make ctxMeter available in context
 			ctx := r.Context()
-			ctxMeter := apiMeter.NewMeter(authn.ForContext(ctx))
+			ctxMeter := apiMeter.NewMeter(authn.ForContextOrAnonymous(ctx))
 			r = r.WithContext(context.WithValue(ctx, meterCtxKey, ctxMeter))
-			if err := ctxMeter.Meter(meterName, meterValue, dims); err != nil {
-				http.Error(w, "429", http.StatusTooManyRequests)
+			if cfg.FlushAfterRequest {
+				defer func() {
+					if err := apiMeter.Flush(); err != nil {
+						log.Error().Err(err).Msg("could not flush meter provider")
+					}
+				}()
+			}
+			dims := cfg.Dims
+			if cfg.DimsFunc != nil {
+				dims = append(append(Dimensions{}, cfg.Dims...), cfg.DimsFunc(r)...)
+			}
+			meter := func(meterName string, value float64) {
+				if err := ctxMeter.Meter(meterName, value, dims); err != nil {
+					log.Error().Err(err).Str("meter", meterName).Msg("could not record meter event")
+				}
+			}
+			checker, _ := ctxMeter.(LimitChecker)
+			reject := func(err error) {
+				if cfg.RecordRateLimited {
+					rlDims := append(Dimensions{}, dims...)
+					rlDims = append(rlDims, Dimension{Key: RateLimitedDimension, Value: "true"})
+					// The user is over a limit, so record without checking limits when possible
+					record := ctxMeter.Meter
+					if checker != nil {
+						record = checker.MeterWithoutLimits
+					}
+					if err := record(cfg.MeterName, 0, rlDims); err != nil {
+						log.Error().Err(err).Str("meter", cfg.MeterName).Msg("could not record rate limited event")
+					}
+				}
+				if v, ok := retryAfter(err, time.Now()); ok {
+					w.Header().Set("Retry-After", v)
+				}
+				http.Error(w, makeRateLimitJsonError(http.StatusText(http.StatusTooManyRequests), err), http.StatusTooManyRequests)
+			}
+			// Events that depend on the response are recorded after the handler,
+			// with limits checked before it when the meter supports it
+			afterHandler := cfg.ValueFunc != nil || cfg.SuccessFunc != nil
+			var err error
+			if !afterHandler {
+				err = ctxMeter.Meter(cfg.MeterName, cfg.MeterValue, dims)
+			} else if checker != nil {
+				err = checker.CheckLimits(cfg.MeterName, cfg.MeterValue, dims)
+			}
+			if errors.Is(err, ErrRateLimited) {
+				reject(err)
 				return
+			} else if err != nil {
+				// Fail open
+				log.Error().Err(err).Str("meter", cfg.MeterName).Msg("could not check meter limits")
+			}
+			var mw *meterResponseWriter
+			if afterHandler || cfg.ResponseBytesMeter != "" {
+				mw = newMeterResponseWriter(w)
+				w = mw
+			}
+			var body *countingReadCloser
+			if cfg.RequestBytesMeter != "" && r.Body != nil {
+				body = &countingReadCloser{ReadCloser: r.Body}
+				r.Body = body
 			}
 			next.ServeHTTP(w, r)
+			if afterHandler && (cfg.SuccessFunc == nil || cfg.SuccessFunc(mw.statusCode)) {
+				value := cfg.MeterValue
+				if cfg.ValueFunc != nil {
+					value = cfg.ValueFunc(r, mw.responseInfo())
+				}
+				if checker != nil {
+					// The request was already admitted; record the event even if it now exceeds a limit
+					if err := checker.MeterWithoutLimits(cfg.MeterName, value, dims); err != nil {
+						log.Error().Err(err).Str("meter", cfg.MeterName).Msg("could not record meter event")
+					}
+				} else {
+					meter(cfg.MeterName, value)
+				}
+			}
+			if cfg.RequestBytesMeter != "" {
+				// Prefer Content-Length; the handler may not read the entire body
+				n := r.ContentLength
+				if n < 0 && body != nil {
+					n = body.bytesRead
+				}
+				meter(cfg.RequestBytesMeter, float64(max(n, 0)))
+			}
+			if cfg.ResponseBytesMeter != "" {
+				meter(cfg.ResponseBytesMeter, float64(mw.bytesWritten))
+			}
 		})
 	}
 }
 
+// Shutdown flushes pending events and closes the provider.
+func Shutdown(apiMeter MeterProvider) error {
+	return errors.Join(apiMeter.Flush(), apiMeter.Close())
+}
+
+// ShutdownContext is Shutdown bounded by the context deadline.
+func ShutdownContext(ctx context.Context, apiMeter MeterProvider) error {
+	return errors.Join(FlushContext(ctx, apiMeter), CloseContext(ctx, apiMeter))
+}
+
+// ContextFlusher is an optional interface for providers that can bound Flush with a context.
+type ContextFlusher interface {
+	FlushContext(context.Context) error
+}
+
+// ContextCloser is an optional interface for providers that can bound Close with a context.
+type ContextCloser interface {
+	CloseContext(context.Context) error
+}
+
+// FlushContext flushes the provider, returning the context error if it is done first.
+// Providers that do not implement ContextFlusher continue flushing in the background after the context is done.
+func FlushContext(ctx context.Context, apiMeter MeterProvider) error {
+	if cf, ok := apiMeter.(ContextFlusher); ok {
+		return cf.FlushContext(ctx)
+	}
+	return runContext(ctx, apiMeter.Flush)
+}
+
+// CloseContext closes the provider, returning the context error if it is done first.
+// Providers that do not implement ContextCloser continue closing in the background after the context is done.
+func CloseContext(ctx context.Context, apiMeter MeterProvider) error {
+	if cc, ok := apiMeter.(ContextCloser); ok {
+		return cc.CloseContext(ctx)
+	}
+	return runContext(ctx, apiMeter.Close)
+}
+
+func runContext(ctx context.Context, fn func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func ForContext(ctx context.Context) ApiMeter {
 	raw, _ := ctx.Value(meterCtxKey).(ApiMeter)
 	return raw
@@ -72,13 +291,37 @@ func DimsContainedIn(checkDims Dimensions, eventDims Dimensions) bool {
 	return true
 }
 
+// DimsEqual checks if two sets of dimensions are the same, ignoring order.
+func DimsEqual(a Dimensions, b Dimensions) bool {
+	return len(a) == len(b) && DimsContainedIn(a, b) && DimsContainedIn(b, a)
+}
+
 // Periods
 
+const rollingPrefix = "rolling:"
+
+// PeriodSpan returns the start and end time of the current period.
+// Named periods (hourly, daily, monthly, yearly, total) are calendar-aligned in UTC.
+// Rolling windows are specified as "rolling:<duration>", e.g. "rolling:1h", and return (end-duration, end),
+// where end is now rounded up to a step of 1/60th of the duration, between one second and one minute.
+// Rounding keeps the span stable between steps, so that it can be used as a cache key.
+// The window is short by less than one step, and never excludes recent usage.
 func PeriodSpan(period string) (time.Time, time.Time, error) {
 	now := time.Now().In(time.UTC)
 	d1 := now
 	d2 := now
-	if period == "hourly" {
+	if strings.HasPrefix(period, rollingPrefix) {
+		d, err := time.ParseDuration(strings.TrimPrefix(period, rollingPrefix))
+		if err != nil || d <= 0 {
+			return now, now, fmt.Errorf("invalid rolling period: %s", period)
+		}
+		step := rollingStep(d)
+		d2 = now.Truncate(step)
+		if d2.Before(now) {
+			d2 = d2.Add(step)
+		}
+		d1 = d2.Add(-d)
+	} else if period == "hourly" {
 		d1 = time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, time.UTC)
 		d2 = d1.Add(3600 * time.Second)
 	} else if period == "daily" {
@@ -98,3 +341,15 @@ func PeriodSpan(period string) (time.Time, time.Time, error) {
 	}
 	return d1, d2, nil
 }
+
+// rollingStep returns the rounding step for a rolling window of the given duration.
+func rollingStep(d time.Duration) time.Duration {
+	step := (d / 60).Truncate(time.Second)
+	if step < time.Second {
+		return time.Second
+	}
+	if step > time.Minute {
+		return time.Minute
+	}
+	return step
+}
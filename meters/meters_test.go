@@ -0,0 +1,376 @@
+package meters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodSpan(t *testing.T) {
+	tcs := []struct {
+		period   string
+		duration time.Duration
+		ok       bool
+	}{
+		{"hourly", time.Hour, true},
+		{"daily", 24 * time.Hour, true},
+		{"rolling:1h", time.Hour, true},
+		{"rolling:24h", 24 * time.Hour, true},
+		{"rolling:90m", 90 * time.Minute, true},
+		{"rolling:", 0, false},
+		{"rolling:abc", 0, false},
+		{"rolling:-1h", 0, false},
+		{"unknown", 0, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.period, func(t *testing.T) {
+			d1, d2, err := PeriodSpan(tc.period)
+			if !tc.ok {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.duration, d2.Sub(d1))
+		})
+	}
+	t.Run("rolling ends now", func(t *testing.T) {
+		now := time.Now()
+		_, d2, err := PeriodSpan("rolling:1h")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, d2.Before(now.Truncate(time.Second)), "expected end not before now")
+		assert.WithinDuration(t, now, d2, time.Minute)
+		assert.Equal(t, d2, d2.Truncate(time.Minute), "expected end rounded to the minute")
+	})
+}
+
+func TestRollingStep(t *testing.T) {
+	tcs := []struct {
+		d      time.Duration
+		expect time.Duration
+	}{
+		{10 * time.Second, time.Second},
+		{10 * time.Minute, 10 * time.Second},
+		{time.Hour, time.Minute},
+		{24 * time.Hour, time.Minute},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.d.String(), func(t *testing.T) {
+			assert.Equal(t, tc.expect, rollingStep(tc.d))
+		})
+	}
+}
+
+func TestDimsEqual(t *testing.T) {
+	a := Dimension{Key: "a", Value: "1"}
+	b := Dimension{Key: "b", Value: "2"}
+	tcs := []struct {
+		name   string
+		x      Dimensions
+		y      Dimensions
+		expect bool
+	}{
+		{"empty", nil, Dimensions{}, true},
+		{"same", Dimensions{a, b}, Dimensions{a, b}, true},
+		{"order", Dimensions{a, b}, Dimensions{b, a}, true},
+		{"subset", Dimensions{a}, Dimensions{a, b}, false},
+		{"superset", Dimensions{a, b}, Dimensions{a}, false},
+		{"value", Dimensions{a}, Dimensions{{Key: "a", Value: "2"}}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, DimsEqual(tc.x, tc.y))
+		})
+	}
+}
+
+func TestWithMeter(t *testing.T) {
+	t.Run("no user", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		h := WithMeter(mp, "test", 1, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []testMeterEvent{{user: "", name: "test", value: 1}}, mp.events)
+	})
+	t.Run("user", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		h := WithMeter(mp, "test", 1, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(authn.WithUser(req.Context(), authn.NewCtxUser("test", "", "")))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []testMeterEvent{{user: "test", name: "test", value: 1}}, mp.events)
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		for _, recordRateLimited := range []bool{false, true} {
+			mp := newTestMeterProvider()
+			mp.limit = 1
+			h := WithMeterConfig(mp, MeterConfig{
+				MeterName:         "test",
+				MeterValue:        1,
+				Dims:              Dimensions{{Key: "a", Value: "b"}},
+				RecordRateLimited: recordRateLimited,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			var codes []int
+			for i := 0; i < 2; i++ {
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+				codes = append(codes, rr.Code)
+			}
+			assert.Equal(t, []int{200, 429}, codes)
+			expect := []testMeterEvent{{name: "test", value: 1, dims: Dimensions{{Key: "a", Value: "b"}}}}
+			if recordRateLimited {
+				expect = append(expect, testMeterEvent{name: "test", value: 0, dims: Dimensions{{Key: "a", Value: "b"}, {Key: RateLimitedDimension, Value: "true"}}})
+			}
+			assert.Equal(t, expect, mp.events)
+		}
+	})
+	t.Run("dims func", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		dims := Dimensions{{Key: "api", Value: "rest"}}
+		h := WithMeterConfig(mp, MeterConfig{
+			MeterName:  "test",
+			MeterValue: 1,
+			Dims:       dims,
+			DimsFunc: func(r *http.Request) Dimensions {
+				return Dimensions{{Key: "method", Value: r.Method}}
+			},
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(method, "/", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}
+		assert.Equal(t, []testMeterEvent{
+			{name: "test", value: 1, dims: Dimensions{{Key: "api", Value: "rest"}, {Key: "method", Value: "GET"}}},
+			{name: "test", value: 1, dims: Dimensions{{Key: "api", Value: "rest"}, {Key: "method", Value: "POST"}}},
+		}, mp.events)
+		// Static dims are not modified
+		assert.Equal(t, Dimensions{{Key: "api", Value: "rest"}}, dims)
+	})
+	t.Run("flush after request", func(t *testing.T) {
+		for _, flush := range []bool{false, true} {
+			mp := newTestMeterProvider()
+			h := WithMeterConfig(mp, MeterConfig{
+				MeterName:         "test",
+				MeterValue:        1,
+				FlushAfterRequest: flush,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, 0, mp.flushed)
+			}))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			if flush {
+				assert.Equal(t, 1, mp.flushed)
+			} else {
+				assert.Equal(t, 0, mp.flushed)
+			}
+		}
+	})
+	t.Run("rate limit body", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		mp.limit = 1
+		h := WithMeter(mp, "test", 2, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.JSONEq(t, `{"error":"Too Many Requests","meter":"test","period":"","limit":1,"current":0}`, rr.Body.String())
+		assert.Equal(t, "", rr.Header().Get("Retry-After"))
+	})
+	t.Run("meter error fails open", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		mp.err = errors.New("backend unavailable")
+		called := false
+		h := WithMeterConfig(mp, MeterConfig{
+			MeterName:         "test",
+			MeterValue:        1,
+			RecordRateLimited: true,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.True(t, called)
+		assert.Empty(t, mp.events)
+	})
+}
+
+func TestRateLimitError(t *testing.T) {
+	var err error = &RateLimitError{MeterName: "test", Period: "hourly", Limit: 10, Current: 10}
+	assert.ErrorIs(t, err, ErrRateLimited)
+	var rlErr *RateLimitError
+	if assert.ErrorAs(t, err, &rlErr) {
+		assert.Equal(t, 10.0, rlErr.Limit)
+	}
+	assert.JSONEq(t, `{"error":"limited"}`, makeRateLimitJsonError("limited", errors.New("other")))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	tcs := []struct {
+		name   string
+		err    error
+		expect string
+		ok     bool
+	}{
+		{"hourly", &RateLimitError{Period: "hourly", ResetAt: now.Add(30 * time.Minute)}, "1800", true},
+		{"partial second", &RateLimitError{Period: "daily", ResetAt: now.Add(1500 * time.Millisecond)}, "2", true},
+		{"total", &RateLimitError{Period: "total", ResetAt: time.Unix(1<<63-1, 0)}, "", false},
+		{"rolling", &RateLimitError{Period: "rolling:1h", ResetAt: now.Add(time.Minute)}, "", false},
+		{"other error", errors.New("other"), "", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := retryAfter(tc.err, now)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expect, v)
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	mp := newTestMeterProvider()
+	assert.NoError(t, Shutdown(mp))
+	assert.Equal(t, 1, mp.flushed)
+	assert.True(t, mp.closed)
+}
+
+func TestShutdownContext(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		mp := newTestMeterProvider()
+		assert.NoError(t, ShutdownContext(context.Background(), mp))
+		assert.Equal(t, 1, mp.flushed)
+		assert.True(t, mp.closed)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		mp := &slowMeterProvider{MeterProvider: newTestMeterProvider(), release: release}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, FlushContext(ctx, mp), context.DeadlineExceeded)
+		assert.ErrorIs(t, ShutdownContext(ctx, mp), context.DeadlineExceeded)
+	})
+	t.Run("context flusher", func(t *testing.T) {
+		mp := &ctxMeterProvider{MeterProvider: newTestMeterProvider()}
+		assert.NoError(t, FlushContext(context.Background(), mp))
+		assert.True(t, mp.flushedContext)
+	})
+}
+
+type slowMeterProvider struct {
+	MeterProvider
+	release chan struct{}
+}
+
+func (m *slowMeterProvider) Flush() error {
+	<-m.release
+	return nil
+}
+
+type ctxMeterProvider struct {
+	MeterProvider
+	flushedContext bool
+}
+
+func (m *ctxMeterProvider) FlushContext(ctx context.Context) error {
+	m.flushedContext = true
+	return nil
+}
+
+// Minimal provider for middleware tests; the meters package cannot import its implementations.
+
+type testMeterEvent struct {
+	user  string
+	name  string
+	value float64
+	dims  Dimensions
+}
+
+type testMeterProvider struct {
+	limit   float64 // reject non-zero events past this total, if set
+	err     error   // return from Meter, if set
+	events  []testMeterEvent
+	flushed int
+	closed  bool
+	lock    sync.Mutex
+}
+
+func newTestMeterProvider() *testMeterProvider {
+	return &testMeterProvider{}
+}
+
+func (m *testMeterProvider) GetValue(user MeterUser, meterName string, start time.Time, end time.Time, dims Dimensions) (float64, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	total := 0.0
+	for _, e := range m.events {
+		if e.user == user.ID() && e.name == meterName && DimsContainedIn(dims, e.dims) {
+			total += e.value
+		}
+	}
+	return total, true
+}
+
+func (m *testMeterProvider) NewMeter(user MeterUser) ApiMeter {
+	return &testMeter{user: user, mp: m}
+}
+
+func (m *testMeterProvider) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *testMeterProvider) Flush() error {
+	m.flushed += 1
+	return nil
+}
+
+type testMeter struct {
+	user MeterUser
+	mp   *testMeterProvider
+}
+
+func (m *testMeter) Meter(meterName string, value float64, dims Dimensions) error {
+	if m.mp.err != nil {
+		return m.mp.err
+	}
+	if m.mp.limit > 0 && value > 0 {
+		if current, _ := m.GetValue(meterName, time.Time{}, time.Time{}, nil); current+value > m.mp.limit {
+			return &RateLimitError{MeterName: meterName, Limit: m.mp.limit, Current: current}
+		}
+	}
+	m.mp.lock.Lock()
+	defer m.mp.lock.Unlock()
+	m.mp.events = append(m.mp.events, testMeterEvent{user: m.user.ID(), name: meterName, value: value, dims: dims})
+	return nil
+}
+
+func (m *testMeter) AddDimension(meterName string, key string, value string) {}
+
+func (m *testMeter) GetValue(meterName string, start time.Time, end time.Time, dims Dimensions) (float64, bool) {
+	return m.mp.GetValue(m.user, meterName, start, end, dims)
+}
+
+func TestGetValues(t *testing.T) {
+	mp := newTestMeterProvider()
+	user := authn.NewCtxUser("test", "", "")
+	m := mp.NewMeter(user)
+	m.Meter("a", 1, nil)
+	m.Meter("b", 2, nil)
+	vals := GetValues(mp, user, []string{"a", "b"}, time.Time{}, time.Time{}, nil)
+	assert.Equal(t, map[string]float64{"a": 1, "b": 2}, vals)
+}
@@ -0,0 +1,46 @@
+package noop
+
+import (
+	"time"
+
+	"github.com/interline-io/transitland-mw/meters"
+)
+
+func init() {
+	var _ meters.MeterProvider = &NoopMeterProvider{}
+}
+
+// NoopMeterProvider discards all events; use it when metering is disabled.
+type NoopMeterProvider struct{}
+
+func NewNoopMeterProvider() *NoopMeterProvider {
+	return &NoopMeterProvider{}
+}
+
+func (m *NoopMeterProvider) Flush() error {
+	return nil
+}
+
+func (m *NoopMeterProvider) Close() error {
+	return nil
+}
+
+func (m *NoopMeterProvider) NewMeter(user meters.MeterUser) meters.ApiMeter {
+	return &noopMeter{}
+}
+
+func (m *NoopMeterProvider) GetValue(u meters.MeterUser, meterName string, startTime time.Time, endTime time.Time, checkDims meters.Dimensions) (float64, bool) {
+	return 0, false
+}
+
+type noopMeter struct{}
+
+func (m *noopMeter) Meter(meterName string, value float64, extraDimensions meters.Dimensions) error {
+	return nil
+}
+
+func (m *noopMeter) AddDimension(meterName string, key string, value string) {}
+
+func (m *noopMeter) GetValue(meterName string, startTime time.Time, endTime time.Time, dims meters.Dimensions) (float64, bool) {
+	return 0, false
+}
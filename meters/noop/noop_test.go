@@ -0,0 +1,35 @@
+package noop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interline-io/transitland-mw/internal/metertest"
+	"github.com/interline-io/transitland-mw/meters"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoopMeter(t *testing.T) {
+	mp := NewNoopMeterProvider()
+	user := metertest.NewTestUser("test", nil)
+	d1, d2, _ := meters.PeriodSpan("hourly")
+	m := mp.NewMeter(user)
+	m.AddDimension("test", "a", "b")
+	assert.NoError(t, m.Meter("test", 1, nil))
+	assert.NoError(t, mp.Flush())
+	v, ok := m.GetValue("test", d1, d2, nil)
+	assert.Equal(t, 0.0, v)
+	assert.False(t, ok)
+	v, ok = mp.GetValue(user, "test", d1, d2, nil)
+	assert.Equal(t, 0.0, v)
+	assert.False(t, ok)
+	assert.NoError(t, mp.Close())
+}
+
+func TestNoopMeter_WithMeter(t *testing.T) {
+	h := meters.WithMeter(NewNoopMeterProvider(), "test", 1, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"time"
 
@@ -59,3 +61,24 @@ func (mw *statusResponseWriter) Write(b []byte) (int, error) {
 func (mw *statusResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.ResponseWriter
 }
+
+func (mw *statusResponseWriter) Flush() {
+	mw.headerWritten = true
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (mw *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := mw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (mw *statusResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := mw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,290 @@
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinSize is the smallest response, in bytes, that will be compressed.
+const DefaultMinSize = 1024
+
+// DefaultContentTypes are the media types compressed when none are configured.
+var DefaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/graphql-response+json",
+	"application/geo+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+type CompressConfig struct {
+	// Level is the gzip/flate compression level; zero uses the default level.
+	Level int
+	// MinSize is the response size below which responses are sent uncompressed; zero uses DefaultMinSize.
+	MinSize int
+	// ContentTypes lists media types to compress; "type/*" matches all subtypes.
+	// Empty uses DefaultContentTypes.
+	ContentTypes []string
+}
+
+// NewCompressMiddleware compresses responses with gzip or deflate, as negotiated by Accept-Encoding.
+// Responses are buffered until MinSize bytes are written or the handler returns;
+// a buffered response is discarded if the handler panics.
+// The status code is passed through to outer response writers unchanged.
+func NewCompressMiddleware(cfg CompressConfig) (func(http.Handler) http.Handler, error) {
+	level := cfg.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid compression level: %d", cfg.Level)
+	}
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+	contentTypes := cfg.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultContentTypes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				level:          level,
+				minSize:        minSize,
+				contentTypes:   contentTypes,
+			}
+			next.ServeHTTP(cw, r)
+			// Not deferred: if the handler panics, the buffered response is discarded
+			// so that a recovery middleware can still send an error status
+			cw.Close()
+		})
+	}, nil
+}
+
+// negotiateEncoding selects gzip or deflate from an Accept-Encoding header, preferring gzip.
+func negotiateEncoding(acceptEncoding string) string {
+	qs := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if pq, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = pq
+			}
+		}
+		qs[name] = q
+	}
+	best := ""
+	bestQ := 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		q, ok := qs[enc]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > bestQ {
+			best = enc
+			bestQ = q
+		}
+	}
+	return best
+}
+
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == a {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response to decide whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding     string
+	level        int
+	minSize      int
+	contentTypes []string
+	statusCode   int
+	buf          []byte
+	decided      bool
+	cw           io.WriteCloser // nil when the response is not compressed
+}
+
+func (mw *compressWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 {
+		// Informational responses are not the final header
+		mw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if mw.decided || mw.statusCode != 0 {
+		return
+	}
+	mw.statusCode = statusCode
+	if !bodyAllowed(statusCode) {
+		mw.decide(false)
+	}
+}
+
+func (mw *compressWriter) Write(b []byte) (int, error) {
+	if mw.statusCode == 0 {
+		mw.statusCode = http.StatusOK
+	}
+	if mw.decided {
+		if mw.cw != nil {
+			return mw.cw.Write(b)
+		}
+		return mw.ResponseWriter.Write(b)
+	}
+	mw.buf = append(mw.buf, b...)
+	if len(mw.buf) >= mw.minSize {
+		if err := mw.decide(mw.eligible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (mw *compressWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+func (mw *compressWriter) Flush() {
+	// Send the buffered response so that streaming handlers are not held back by MinSize
+	if !mw.decided {
+		if mw.statusCode == 0 {
+			mw.statusCode = http.StatusOK
+		}
+		if err := mw.decide(mw.eligible()); err != nil {
+			return
+		}
+	}
+	if f, ok := mw.cw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (mw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := mw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (mw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := mw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Close sends any buffered response and finishes the compressed stream.
+func (mw *compressWriter) Close() error {
+	if !mw.decided {
+		if mw.statusCode == 0 {
+			// Nothing was written; leave the response to net/http
+			return nil
+		}
+		if err := mw.decide(false); err != nil {
+			return err
+		}
+	}
+	if mw.cw != nil {
+		return mw.cw.Close()
+	}
+	return nil
+}
+
+func (mw *compressWriter) eligible() bool {
+	h := mw.Header()
+	if h.Get("Content-Encoding") != "" || !bodyAllowed(mw.statusCode) {
+		return false
+	}
+	return contentTypeAllowed(mw.contentType(), mw.contentTypes)
+}
+
+// contentType returns the response content type, sniffing and setting it if unset.
+// It must be set before compressing, otherwise net/http would sniff the compressed bytes.
+func (mw *compressWriter) contentType() string {
+	h := mw.Header()
+	ct := h.Get("Content-Type")
+	if ct == "" && len(mw.buf) > 0 {
+		ct = http.DetectContentType(mw.buf)
+		h.Set("Content-Type", ct)
+	}
+	return ct
+}
+
+// decide writes the header and any buffered data, compressed or not.
+func (mw *compressWriter) decide(compress bool) error {
+	mw.decided = true
+	h := mw.Header()
+	if compress {
+		var err error
+		if mw.encoding == "gzip" {
+			mw.cw, err = gzip.NewWriterLevel(mw.ResponseWriter, mw.level)
+		} else {
+			mw.cw, err = flate.NewWriter(mw.ResponseWriter, mw.level)
+		}
+		if err != nil {
+			return err
+		}
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", mw.encoding)
+	} else {
+		mw.contentType()
+	}
+	mw.ResponseWriter.WriteHeader(mw.statusCode)
+	buf := mw.buf
+	mw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if mw.cw != nil {
+		_, err = mw.cw.Write(buf)
+	} else {
+		_, err = mw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
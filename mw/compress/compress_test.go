@@ -0,0 +1,206 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"hello":"world"}`, 100)
+	small := `{"hello":"world"}`
+	tcs := []struct {
+		name           string
+		cfg            CompressConfig
+		method         string
+		acceptEncoding string
+		contentType    string
+		encoding       string // existing Content-Encoding
+		code           int
+		body           string
+		expectEncoding string
+	}{
+		{"gzip", CompressConfig{}, "GET", "gzip", "application/json", "", 200, large, "gzip"},
+		{"deflate", CompressConfig{}, "GET", "deflate", "application/json", "", 200, large, "deflate"},
+		{"prefer gzip", CompressConfig{}, "GET", "deflate, gzip", "application/json", "", 200, large, "gzip"},
+		{"q values", CompressConfig{}, "GET", "gzip;q=0.5, deflate;q=0.8", "application/json", "", 200, large, "deflate"},
+		{"gzip disabled", CompressConfig{}, "GET", "gzip;q=0", "application/json", "", 200, large, ""},
+		{"wildcard", CompressConfig{}, "GET", "*", "application/json", "", 200, large, "gzip"},
+		{"no accept encoding", CompressConfig{}, "GET", "", "application/json", "", 200, large, ""},
+		{"identity", CompressConfig{}, "GET", "identity", "application/json", "", 200, large, ""},
+		{"small", CompressConfig{}, "GET", "gzip", "application/json", "", 200, small, ""},
+		{"small min size", CompressConfig{MinSize: 10}, "GET", "gzip", "application/json", "", 200, small, "gzip"},
+		{"text wildcard", CompressConfig{}, "GET", "gzip", "text/html; charset=utf-8", "", 200, large, "gzip"},
+		{"sniffed", CompressConfig{}, "GET", "gzip", "", "", 200, large, "gzip"},
+		{"content type not allowed", CompressConfig{}, "GET", "gzip", "image/png", "", 200, large, ""},
+		{"content types config", CompressConfig{ContentTypes: []string{"image/png"}}, "GET", "gzip", "image/png", "", 200, large, "gzip"},
+		{"already encoded", CompressConfig{}, "GET", "gzip", "application/json", "br", 200, large, "br"},
+		{"status code", CompressConfig{}, "GET", "gzip", "application/json", "", 404, large, "gzip"},
+		{"no content", CompressConfig{}, "GET", "gzip", "", "", 204, "", ""},
+		{"head", CompressConfig{}, "HEAD", "gzip", "application/json", "", 200, "", ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mwf, err := NewCompressMiddleware(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.WriteHeader(tc.code)
+				// Write in several parts to exercise buffering
+				for i := 0; i < len(tc.body); i += 100 {
+					w.Write([]byte(tc.body[i:min(i+100, len(tc.body))]))
+				}
+			}))
+			req := httptest.NewRequest(tc.method, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, tc.code, rr.Code)
+			assert.Equal(t, tc.expectEncoding, rr.Header().Get("Content-Encoding"))
+			assert.Contains(t, rr.Header().Values("Vary"), "Accept-Encoding")
+			var body io.Reader = rr.Body
+			switch tc.expectEncoding {
+			case "gzip":
+				body, err = gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			case "deflate":
+				body = flate.NewReader(rr.Body)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.body, string(got))
+		})
+	}
+}
+
+func TestNewCompressMiddleware_Level(t *testing.T) {
+	_, err := NewCompressMiddleware(CompressConfig{Level: gzip.BestSpeed})
+	assert.NoError(t, err)
+	_, err = NewCompressMiddleware(CompressConfig{Level: 100})
+	assert.Error(t, err)
+}
+
+func TestNewCompressMiddleware_OuterWriter(t *testing.T) {
+	// Outer response writers see the handler status code
+	mwf, err := NewCompressMiddleware(CompressConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(`{}`))
+	}))
+	outer := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(outer, req)
+	assert.Equal(t, http.StatusTeapot, outer.statusCode)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func TestNewCompressMiddleware_Panic(t *testing.T) {
+	mwf, err := NewCompressMiddleware(CompressConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"partial":`))
+		panic("test")
+	}))
+	// Stand-in for a recovery middleware
+	recoverer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				http.Error(w, "error", http.StatusInternalServerError)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	recoverer.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "error\n", rr.Body.String())
+}
+
+func TestCompressWriter_Flush(t *testing.T) {
+	mwf, err := NewCompressMiddleware(CompressConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []string{"data: a\n\n", "data: b\n\n"}
+	var flushedLen []int
+	rr := httptest.NewRecorder()
+	h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		f, ok := w.(http.Flusher)
+		if !assert.True(t, ok) {
+			return
+		}
+		for _, ev := range events {
+			w.Write([]byte(ev))
+			f.Flush()
+			flushedLen = append(flushedLen, rr.Body.Len())
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(rr, req)
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	// Each flush sends data below MinSize to the client
+	if assert.Len(t, flushedLen, 2) {
+		assert.Greater(t, flushedLen[0], 0)
+		assert.Greater(t, flushedLen[1], flushedLen[0])
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.Join(events, ""), string(got))
+}
+
+func TestCompressWriter_Hijack(t *testing.T) {
+	var w http.ResponseWriter = &compressWriter{ResponseWriter: httptest.NewRecorder()}
+	h, ok := w.(http.Hijacker)
+	if assert.True(t, ok) {
+		_, _, err := h.Hijack()
+		assert.ErrorIs(t, err, http.ErrNotSupported)
+	}
+}
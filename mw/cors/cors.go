@@ -0,0 +1,188 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultAllowedMethods are used when no methods are configured.
+var DefaultAllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// DefaultAllowedHeaders are used when no headers are configured.
+var DefaultAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Request-Id"}
+
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" to allow any origin, or a single wildcard such as "https://*.example.com".
+	AllowedOrigins []string
+	// AllowedMethods defaults to DefaultAllowedMethods.
+	AllowedMethods []string
+	// AllowedHeaders defaults to DefaultAllowedHeaders; "*" allows any requested header.
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and Authorization headers on cross-origin requests.
+	// It requires explicit AllowedOrigins; "*" is rejected, since it would allow credentialed requests from any site.
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, preflight results may be cached; zero omits the header.
+	MaxAge int
+}
+
+// NewCORSMiddleware sets Access-Control-Allow-* headers for allowed origins.
+// Preflight requests are answered with 204 and do not reach the next handler,
+// so it should run ahead of any auth middleware.
+func NewCORSMiddleware(cfg CORSConfig) (func(http.Handler) http.Handler, error) {
+	c := corsHandler{
+		allowedMethods:   cfg.AllowedMethods,
+		allowedHeaders:   map[string]bool{},
+		exposedHeaders:   strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+	}
+	if len(c.allowedMethods) == 0 {
+		c.allowedMethods = DefaultAllowedMethods
+	}
+	allowedHeaders := cfg.AllowedHeaders
+	if len(allowedHeaders) == 0 {
+		allowedHeaders = DefaultAllowedHeaders
+	}
+	for _, h := range allowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+		}
+		c.allowedHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			if cfg.AllowCredentials {
+				return nil, errors.New(`allowed origin "*" can not be used with credentials`)
+			}
+			c.anyOrigin = true
+			continue
+		}
+		switch strings.Count(o, "*") {
+		case 0:
+			c.origins = append(c.origins, originPattern{prefix: o})
+		case 1:
+			prefix, suffix, _ := strings.Cut(o, "*")
+			c.origins = append(c.origins, originPattern{prefix: prefix, suffix: suffix, wildcard: true})
+		default:
+			return nil, fmt.Errorf("invalid origin pattern: %s", o)
+		}
+	}
+	if cfg.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(cfg.MaxAge)
+	}
+	return c.middleware, nil
+}
+
+type originPattern struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+}
+
+func (p originPattern) match(origin string) bool {
+	if !p.wildcard {
+		return origin == p.prefix
+	}
+	return len(origin) > len(p.prefix)+len(p.suffix) && strings.HasPrefix(origin, p.prefix) && strings.HasSuffix(origin, p.suffix)
+}
+
+type corsHandler struct {
+	anyOrigin        bool
+	origins          []originPattern
+	allowedMethods   []string
+	anyHeader        bool
+	allowedHeaders   map[string]bool
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+func (c *corsHandler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if c.originAllowed(origin) {
+				c.setPreflightHeaders(h, r, origin)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if origin != "" && c.originAllowed(origin) {
+			c.setOriginHeaders(h, origin)
+			if c.exposedHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *corsHandler) setPreflightHeaders(h http.Header, r *http.Request, origin string) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.methodAllowed(method) {
+		return
+	}
+	var reqHeaders []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, rh := range strings.Split(v, ",") {
+			if rh = strings.TrimSpace(rh); rh != "" {
+				reqHeaders = append(reqHeaders, rh)
+			}
+		}
+	}
+	for _, rh := range reqHeaders {
+		if !c.anyHeader && !c.allowedHeaders[http.CanonicalHeaderKey(rh)] {
+			return
+		}
+	}
+	c.setOriginHeaders(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.allowedMethods, ", "))
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+}
+
+func (c *corsHandler) setOriginHeaders(h http.Header, origin string) {
+	if c.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *corsHandler) originAllowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, p := range c.origins {
+		if p.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *corsHandler) methodAllowed(method string) bool {
+	for _, m := range c.allowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCORSMiddleware(t *testing.T) {
+	tcs := []struct {
+		name          string
+		cfg           CORSConfig
+		method        string
+		headers       map[string]string
+		code          int
+		nextCalled    bool
+		expectHeaders map[string]string
+	}{
+		{
+			"no origin",
+			CORSConfig{AllowedOrigins: []string{"*"}},
+			"GET",
+			nil,
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"any origin",
+			CORSConfig{AllowedOrigins: []string{"*"}},
+			"GET",
+			map[string]string{"Origin": "https://example.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			"exact origin with credentials",
+			CORSConfig{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true},
+			"GET",
+			map[string]string{"Origin": "https://example.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Credentials": "true"},
+		},
+		{
+			"exact origin",
+			CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			"GET",
+			map[string]string{"Origin": "https://EXAMPLE.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": "https://EXAMPLE.com"},
+		},
+		{
+			"origin not allowed",
+			CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			"GET",
+			map[string]string{"Origin": "https://other.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"subdomain",
+			CORSConfig{AllowedOrigins: []string{"https://*.example.com"}},
+			"GET",
+			map[string]string{"Origin": "https://app.example.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+		},
+		{
+			"subdomain does not match apex",
+			CORSConfig{AllowedOrigins: []string{"https://*.example.com"}},
+			"GET",
+			map[string]string{"Origin": "https://example.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"subdomain does not match other domain",
+			CORSConfig{AllowedOrigins: []string{"https://*.example.com"}},
+			"GET",
+			map[string]string{"Origin": "https://app.example.com.evil.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"exposed headers",
+			CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Request-Id", "Retry-After"}},
+			"GET",
+			map[string]string{"Origin": "https://example.com"},
+			200,
+			true,
+			map[string]string{"Access-Control-Expose-Headers": "X-Request-Id, Retry-After"},
+		},
+		{
+			"preflight",
+			CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: 600},
+			"OPTIONS",
+			map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "authorization, content-type"},
+			204,
+			false,
+			map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST",
+				"Access-Control-Allow-Headers": "authorization, content-type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			"preflight method not allowed",
+			CORSConfig{AllowedOrigins: []string{"*"}},
+			"OPTIONS",
+			map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "DELETE"},
+			204,
+			false,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			"preflight header not allowed",
+			CORSConfig{AllowedOrigins: []string{"*"}},
+			"OPTIONS",
+			map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-other"},
+			204,
+			false,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"preflight any header",
+			CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}},
+			"OPTIONS",
+			map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-other"},
+			204,
+			false,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "x-other"},
+		},
+		{
+			"preflight origin not allowed",
+			CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			"OPTIONS",
+			map[string]string{"Origin": "https://other.com", "Access-Control-Request-Method": "GET"},
+			204,
+			false,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			"options without preflight headers",
+			CORSConfig{AllowedOrigins: []string{"*"}},
+			"OPTIONS",
+			nil,
+			200,
+			true,
+			nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mwf, err := NewCORSMiddleware(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nextCalled := false
+			h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+			}))
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, tc.code, rr.Code)
+			assert.Equal(t, tc.nextCalled, nextCalled)
+			assert.Contains(t, rr.Header().Values("Vary"), "Origin")
+			for k, v := range tc.expectHeaders {
+				assert.Equal(t, v, rr.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestNewCORSMiddleware_InvalidOrigin(t *testing.T) {
+	_, err := NewCORSMiddleware(CORSConfig{AllowedOrigins: []string{"https://*.*.example.com"}})
+	assert.Error(t, err)
+}
+
+func TestNewCORSMiddleware_AnyOriginWithCredentials(t *testing.T) {
+	_, err := NewCORSMiddleware(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.Error(t, err)
+}
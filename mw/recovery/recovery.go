@@ -0,0 +1,71 @@
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/interline-io/log"
+	"github.com/interline-io/transitland-mw/meters"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PanicDimension tags failure events recorded for panics.
+const PanicDimension = "panic"
+
+type RecoveryConfig struct {
+	// FailureMeter, if set, records an event on the context meter when a handler panics.
+	// The recovery middleware must run inside meters.WithMeter for the context meter to be available.
+	FailureMeter string
+}
+
+// RecoveryMiddleware recovers from handler panics and responds with a 500 JSON error.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return NewRecoveryMiddleware(RecoveryConfig{})(next)
+}
+
+// NewRecoveryMiddleware recovers from handler panics, records the panic on the active span,
+// logs the stack, and responds with a 500 JSON error.
+// It must run inside the tracing middleware so that the span is still active when the panic is recorded.
+func NewRecoveryMiddleware(cfg RecoveryConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					// Deliberate abort; let net/http handle it
+					panic(rec)
+				}
+				ctx := r.Context()
+				err := fmt.Errorf("panic: %v", rec)
+				stack := debug.Stack()
+				span := trace.SpanFromContext(ctx)
+				span.RecordError(err, trace.WithStackTrace(true))
+				span.SetStatus(codes.Error, err.Error())
+				log.Error().Err(err).Str("method", r.Method).Str("path", r.URL.EscapedPath()).Bytes("stack", stack).Msg("recovered from panic")
+				if cfg.FailureMeter != "" {
+					if m := meters.ForContext(ctx); m != nil {
+						if err := m.Meter(cfg.FailureMeter, 1, meters.Dimensions{{Key: PanicDimension, Value: "true"}}); err != nil {
+							log.Error().Err(err).Str("meter", cfg.FailureMeter).Msg("could not record panic")
+						}
+					}
+				}
+				http.Error(w, makeJsonError(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func makeJsonError(msg string) string {
+	a := map[string]string{
+		"error": msg,
+	}
+	jj, _ := json.Marshal(&a)
+	return string(jj)
+}
@@ -0,0 +1,85 @@
+package recovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/interline-io/transitland-mw/meters"
+	localmeter "github.com/interline-io/transitland-mw/meters/local"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	t.Run("panic", func(t *testing.T) {
+		span := &testSpan{}
+		h := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(trace.ContextWithSpan(req.Context(), span))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.JSONEq(t, `{"error":"Internal Server Error"}`, rr.Body.String())
+		if assert.Len(t, span.errs, 1) {
+			assert.EqualError(t, span.errs[0], "panic: test")
+		}
+		assert.Equal(t, codes.Error, span.code)
+	})
+	t.Run("no panic", func(t *testing.T) {
+		span := &testSpan{}
+		h := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(trace.ContextWithSpan(req.Context(), span))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "ok", rr.Body.String())
+		assert.Len(t, span.errs, 0)
+		assert.Equal(t, codes.Unset, span.code)
+	})
+	t.Run("abort handler", func(t *testing.T) {
+		h := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+	t.Run("failure meter", func(t *testing.T) {
+		mp := localmeter.NewLocalMeterProvider()
+		defer mp.Close()
+		h := meters.WithMeter(mp, "requests", 1, nil)(
+			NewRecoveryMiddleware(RecoveryConfig{FailureMeter: "failures"})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic("test")
+				})))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		d1, d2, _ := meters.PeriodSpan("hourly")
+		v, _ := mp.GetValue(authn.NewCtxUser("", "", ""), "failures", d1, d2, meters.Dimensions{{Key: PanicDimension, Value: "true"}})
+		assert.Equal(t, 1.0, v)
+	})
+}
+
+type testSpan struct {
+	noop.Span
+	errs []error
+	code codes.Code
+}
+
+func (s *testSpan) RecordError(err error, opts ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *testSpan) SetStatus(code codes.Code, description string) {
+	s.code = code
+}
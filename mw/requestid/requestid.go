@@ -0,0 +1,60 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/interline-io/log"
+	"github.com/xtgo/uuid"
+)
+
+// RequestIDHeader is read from requests and set on responses.
+const RequestIDHeader = "X-Request-Id"
+
+// Incoming request IDs longer than this are replaced
+const maxRequestIDLength = 128
+
+var ctxRequestIDKey = &contextKey{"requestId"}
+
+type contextKey struct {
+	name string
+}
+
+// RequestIDMiddleware assigns each request an ID, honoring a valid incoming X-Request-Id header.
+// The ID is set on the request header, so that log.RequestIDMiddleware (and chi's RequestID middleware,
+// if used further down the chain) read the same value, and on the response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	next = log.RequestIDMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewRandom().String()
+		}
+		r.Header.Set(RequestIDHeader, requestID)
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// ForContext returns the request ID, or an empty string if none is set.
+func ForContext(ctx context.Context) string {
+	raw, _ := ctx.Value(ctxRequestIDKey).(string)
+	return raw
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxRequestIDKey, requestID)
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII characters.
+func validRequestID(v string) bool {
+	if v == "" || len(v) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x21 || v[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
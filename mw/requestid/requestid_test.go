@@ -0,0 +1,57 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tcs := []struct {
+		name     string
+		incoming string
+		expect   string // empty for generated
+	}{
+		{"generated", "", ""},
+		{"incoming", "abc-123", "abc-123"},
+		{"incoming with spaces", "abc 123", ""},
+		{"incoming too long", strings.Repeat("a", maxRequestIDLength+1), ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var ctxID, headerID string
+			h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = ForContext(r.Context())
+				headerID = r.Header.Get(RequestIDHeader)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.incoming != "" {
+				req.Header.Set(RequestIDHeader, tc.incoming)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			respID := rr.Header().Get(RequestIDHeader)
+			if tc.expect != "" {
+				assert.Equal(t, tc.expect, ctxID)
+			} else {
+				assert.NotEmpty(t, ctxID)
+				assert.NotEqual(t, tc.incoming, ctxID)
+			}
+			assert.Equal(t, ctxID, headerID)
+			assert.Equal(t, ctxID, respID)
+		})
+	}
+	t.Run("unique", func(t *testing.T) {
+		ids := map[string]bool{}
+		h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ids[ForContext(r.Context())] = true
+		}))
+		for i := 0; i < 10; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		assert.Len(t, ids, 10)
+	})
+}
@@ -0,0 +1,78 @@
+package stack
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/interline-io/transitland-mw/meters"
+	"github.com/interline-io/transitland-mw/mw/compress"
+	"github.com/interline-io/transitland-mw/mw/cors"
+	"github.com/interline-io/transitland-mw/mw/recovery"
+	"github.com/interline-io/transitland-mw/mw/requestid"
+)
+
+// StackConfig selects the layers of a middleware stack; nil or false disables a layer.
+type StackConfig struct {
+	RequestID bool
+	// Recovery enables panic recovery. If FailureMeter is set and metering is enabled,
+	// a second recovery layer is added inside the meter so that panics are recorded.
+	Recovery *recovery.RecoveryConfig
+	CORS     *cors.CORSConfig
+	Compress *compress.CompressConfig
+	// Auth middlewares are applied in order, the first being outermost.
+	Auth []func(http.Handler) http.Handler
+	// MeterProvider and Meter enable metering; both must be set.
+	MeterProvider meters.MeterProvider
+	Meter         *meters.MeterConfig
+}
+
+// BuildMiddlewareStack assembles the enabled middlewares in this order, outermost first:
+//
+//	request ID, recovery, CORS, compression, auth, meter
+//
+// Request IDs are assigned before anything logs, panics in the inner layers and the handler are recovered,
+// CORS preflight requests are answered without auth, error responses from auth and meter are compressed,
+// and the meter sees the authenticated user.
+// On panic, a response still buffered by compression is discarded and replaced with a 500;
+// a response that was already sent to the client can not be replaced.
+// A tracing middleware such as otelhttp should wrap the returned stack, so that spans include the whole request
+// and recovery can record panics on the active span.
+func BuildMiddlewareStack(cfg StackConfig) (func(http.Handler) http.Handler, error) {
+	var mws []func(http.Handler) http.Handler
+	if cfg.RequestID {
+		mws = append(mws, requestid.RequestIDMiddleware)
+	}
+	if cfg.Recovery != nil {
+		mws = append(mws, recovery.NewRecoveryMiddleware(*cfg.Recovery))
+	}
+	if cfg.CORS != nil {
+		mw, err := cors.NewCORSMiddleware(*cfg.CORS)
+		if err != nil {
+			return nil, err
+		}
+		mws = append(mws, mw)
+	}
+	if cfg.Compress != nil {
+		mw, err := compress.NewCompressMiddleware(*cfg.Compress)
+		if err != nil {
+			return nil, err
+		}
+		mws = append(mws, mw)
+	}
+	mws = append(mws, cfg.Auth...)
+	if (cfg.MeterProvider == nil) != (cfg.Meter == nil) {
+		return nil, errors.New("metering requires both MeterProvider and Meter")
+	}
+	if cfg.Meter != nil {
+		mws = append(mws, meters.WithMeterConfig(cfg.MeterProvider, *cfg.Meter))
+		if cfg.Recovery != nil && cfg.Recovery.FailureMeter != "" {
+			mws = append(mws, recovery.NewRecoveryMiddleware(*cfg.Recovery))
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}, nil
+}
@@ -0,0 +1,145 @@
+package stack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interline-io/transitland-mw/auth/authn"
+	"github.com/interline-io/transitland-mw/meters"
+	localmeter "github.com/interline-io/transitland-mw/meters/local"
+	"github.com/interline-io/transitland-mw/mw/compress"
+	"github.com/interline-io/transitland-mw/mw/cors"
+	"github.com/interline-io/transitland-mw/mw/recovery"
+	"github.com/interline-io/transitland-mw/mw/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMiddlewareStack(t *testing.T) {
+	testUser := authn.NewCtxUser("test", "", "")
+	authMw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(authn.WithUser(r.Context(), testUser)))
+		})
+	}
+	newStack := func(t *testing.T, mp meters.MeterProvider) func(http.Handler) http.Handler {
+		mwf, err := BuildMiddlewareStack(StackConfig{
+			RequestID:     true,
+			Recovery:      &recovery.RecoveryConfig{FailureMeter: "failures"},
+			CORS:          &cors.CORSConfig{AllowedOrigins: []string{"*"}},
+			Auth:          []func(http.Handler) http.Handler{authMw},
+			MeterProvider: mp,
+			Meter:         &meters.MeterConfig{MeterName: "requests", MeterValue: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mwf
+	}
+	d1, d2, _ := meters.PeriodSpan("hourly")
+	t.Run("ok", func(t *testing.T) {
+		mp := localmeter.NewLocalMeterProvider()
+		defer mp.Close()
+		var requestID string
+		var user authn.User
+		h := newStack(t, mp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID = requestid.ForContext(r.Context())
+			user = authn.ForContext(r.Context())
+			w.Write([]byte("ok"))
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "test")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, requestID)
+		assert.Equal(t, requestID, rr.Header().Get(requestid.RequestIDHeader))
+		assert.Equal(t, testUser, user)
+		v, _ := mp.GetValue(testUser, "requests", d1, d2, nil)
+		assert.Equal(t, 1.0, v)
+	})
+	t.Run("preflight skips auth", func(t *testing.T) {
+		mp := localmeter.NewLocalMeterProvider()
+		defer mp.Close()
+		h := newStack(t, mp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called")
+		}))
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+		assert.NotEmpty(t, rr.Header().Get(requestid.RequestIDHeader))
+	})
+	t.Run("panic is metered", func(t *testing.T) {
+		mp := localmeter.NewLocalMeterProvider()
+		defer mp.Close()
+		h := newStack(t, mp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "test")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get(requestid.RequestIDHeader))
+		v, _ := mp.GetValue(testUser, "failures", d1, d2, meters.Dimensions{{Key: recovery.PanicDimension, Value: "true"}})
+		assert.Equal(t, 1.0, v)
+	})
+	t.Run("panic in auth", func(t *testing.T) {
+		mwf, err := BuildMiddlewareStack(StackConfig{
+			Recovery: &recovery.RecoveryConfig{},
+			Auth: []func(http.Handler) http.Handler{func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic("auth")
+				})
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mwf(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+	t.Run("panic after partial compressed write", func(t *testing.T) {
+		mwf, err := BuildMiddlewareStack(StackConfig{
+			Recovery: &recovery.RecoveryConfig{},
+			Compress: &compress.CompressConfig{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := mwf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"partial":`))
+			panic("test")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+		assert.JSONEq(t, `{"error":"Internal Server Error"}`, rr.Body.String())
+	})
+	t.Run("meter requires provider", func(t *testing.T) {
+		_, err := BuildMiddlewareStack(StackConfig{Meter: &meters.MeterConfig{MeterName: "requests"}})
+		assert.Error(t, err)
+	})
+	t.Run("empty", func(t *testing.T) {
+		mwf, err := BuildMiddlewareStack(StackConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mwf(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}